@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/analytics"
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/pkg/errors"
+)
+
+// Analyze computes pagerank, degree, betweenness and community for every
+// user in the database, stores the scores with the users and prints the
+// most influential accounts.
+func Analyze(log *log.Logger, gqlConfig data.GraphQLConfig, cfg analytics.Config, top int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	g, err := analytics.Load(ctx, gql, 0)
+	if err != nil {
+		return errors.Wrap(err, "loading graph")
+	}
+	log.Printf("analyze: loaded %d users", g.Len())
+
+	scores := analytics.Analyze(g, cfg)
+
+	if err := analytics.Save(ctx, gql, scores); err != nil {
+		return err
+	}
+	log.Printf("analyze: saved scores for %d users", len(scores))
+
+	users, err := user.TopByPageRank(ctx, gql, top)
+	if err != nil {
+		return errors.Wrap(err, "retrieving top users")
+	}
+
+	fmt.Printf("%-4s %-20s %-10s %-8s %-8s %-12s %s\n", "RANK", "SCREEN NAME", "PAGERANK", "IN", "OUT", "BETWEENNESS", "COMMUNITY")
+	for i, u := range users {
+		fmt.Printf("%-4d %-20s %-10.6f %-8d %-8d %-12.1f %d\n", i+1, u.ScreenName, u.PageRank, u.InDegree, u.OutDegree, u.Betweenness, u.Community)
+	}
+
+	return nil
+}
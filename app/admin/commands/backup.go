@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/backup"
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/ardanlabs/dgraph/foundation/file"
+	"github.com/pkg/errors"
+)
+
+// Backup writes every user, friend edge and follow in the database to the
+// specified file. The file is only replaced once the backup is complete.
+func Backup(log *log.Logger, gqlConfig data.GraphQLConfig, path string) error {
+	if path == "" {
+		return errors.New("backup: missing file, usage: backup <file>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	var stats backup.Stats
+	err = file.WriteAtomicFunc(path, 0644, func(w io.Writer) error {
+		stats, err = backup.Backup(ctx, gql, w, 0)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "writing backup file")
+	}
+
+	log.Printf("backup: %s: wrote %d users, %d friends, %d past friends and %d follows with schema %s", path, stats.Users, stats.Friends, stats.PastFriends, stats.Follows, stats.Schema)
+	return nil
+}
+
+// Restore loads a backup file into the database. The schema must already
+// be created.
+func Restore(log *log.Logger, gqlConfig data.GraphQLConfig, path string) error {
+	if path == "" {
+		return errors.New("restore: missing file, usage: restore <file>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening backup file")
+	}
+	defer f.Close()
+
+	stats, err := backup.Restore(ctx, gql, f)
+	if stats.Schema != "" && stats.Schema != schema.Version() {
+		log.Printf("restore: %s: WARNING: backup has schema %s, database has %s", path, stats.Schema, schema.Version())
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("restore: %s: restored %d users, %d friends, %d past friends and %d follows", path, stats.Users, stats.Friends, stats.PastFriends, stats.Follows)
+	return nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Set of things that can be dropped.
+const (
+	DropAll  = "all"
+	DropData = "data"
+)
+
+// ErrProtected is returned when a drop is attempted against a database that
+// is configured as protected.
+var ErrProtected = errors.New("database is protected, drops are disabled")
+
+// DropConfig represents the settings for a drop. Unless Yes is set, the
+// operator has to type the host of the database to confirm. If Backup is
+// set, a backup is written to that file before anything is dropped.
+type DropConfig struct {
+	What      string
+	Yes       bool
+	Protected bool
+	Backup    string
+}
+
+// Drop removes the data, or the data and the schema, from the database
+// after showing what is about to be removed and getting confirmation.
+func Drop(log *log.Logger, gqlConfig data.GraphQLConfig, cfg DropConfig, in io.Reader, out io.Writer) error {
+	if cfg.What != DropAll && cfg.What != DropData {
+		return errors.New("drop: usage: drop [--yes] [--backup file] all|data")
+	}
+
+	if cfg.Protected {
+		return ErrProtected
+	}
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	users, follows, err := count(gql)
+	if err != nil {
+		return errors.Wrap(err, "counting nodes")
+	}
+
+	host := gqlConfig.URL
+	if u, err := url.Parse(gqlConfig.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	fmt.Fprintf(out, "About to drop %s from %s\n", cfg.What, gqlConfig.URL)
+	fmt.Fprintf(out, "  users:   %d\n", users)
+	fmt.Fprintf(out, "  follows: %d\n", follows)
+
+	if !cfg.Yes {
+		fmt.Fprintf(out, "Type the host %q to confirm: ", host)
+
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "reading confirmation")
+		}
+		if strings.TrimSpace(answer) != host {
+			return errors.New("drop: not confirmed")
+		}
+	}
+
+	if cfg.Backup != "" {
+		if err := Backup(log, gqlConfig, cfg.Backup); err != nil {
+			return errors.Wrap(err, "backing up before drop")
+		}
+	}
+
+	// The operator can take as long as they need to confirm and the backup
+	// has its own timeout, so the drop only starts its clock now.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Dropping doesn't depend on how tokens are verified.
+	schema := schema.New(gql, schema.Authorization{})
+
+	switch cfg.What {
+	case DropAll:
+		err = schema.DropAll(ctx)
+	case DropData:
+		err = schema.DropData(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("drop: dropped %s from %s: %d users and %d follows", cfg.What, gqlConfig.URL, users, follows)
+	return nil
+}
+
+// count returns the number of users and follows that are about to be
+// dropped.
+func count(gql *graphql.GraphQL) (users int, follows int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return user.Count(ctx, gql)
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/export"
+	"github.com/pkg/errors"
+)
+
+// Export writes the graph stored in the database to the specified file. If
+// no format is provided, it's determined by the file extension.
+func Export(log *log.Logger, gqlConfig data.GraphQLConfig, path string, cfg export.Config) error {
+	if path == "" {
+		return errors.New("export: missing file, usage: export [--format graphml|gexf|dot|rdf] [--ego screen_name] <file>")
+	}
+
+	if cfg.Format == "" {
+		format, err := export.FormatFromPath(path)
+		if err != nil {
+			return err
+		}
+		cfg.Format = format
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating export file")
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	stats, err := export.Export(ctx, gql, w, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "writing export file")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "closing export file")
+	}
+
+	log.Printf("export: %s: wrote %d users and %d edges as %s", path, stats.Nodes, stats.Edges, cfg.Format)
+	return nil
+}
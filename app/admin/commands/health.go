@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/ready"
+	"github.com/pkg/errors"
+)
+
+// HealthConfig represents the settings for checking the health of the
+// cluster. Policy is "all" to require every alpha to be healthy or "quorum"
+// to require a majority of every group. When Wait is set, the check is
+// repeated until the policy holds or the wait is over.
+type HealthConfig struct {
+	ZeroURL string
+	Policy  string
+	Wait    time.Duration
+	JSON    bool
+}
+
+// Health reports the health of every node in the cluster as a table or as
+// JSON. It fails if the cluster isn't ready according to the policy.
+func Health(gqlConfig data.GraphQLConfig, cfg HealthConfig, out io.Writer) error {
+	var policy ready.Policy
+	switch cfg.Policy {
+	case "all":
+		policy = ready.AllAlphas
+	case "quorum":
+		policy = ready.Quorum
+	default:
+		return fmt.Errorf("unknown policy %q, must be all or quorum", cfg.Policy)
+	}
+
+	client, err := data.NewHealthClient(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "constructing health client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Wait+5*time.Second)
+	defer cancel()
+
+	var report ready.Report
+	var notReady error
+	if cfg.Wait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, cfg.Wait)
+		defer cancel()
+		report, notReady = ready.ValidateCluster(waitCtx, client, gqlConfig.URL, cfg.ZeroURL, policy, time.Second)
+	} else {
+		if report, err = ready.Check(ctx, client, gqlConfig.URL, cfg.ZeroURL); err != nil {
+			return errors.Wrap(err, "checking health")
+		}
+		notReady = policy(report)
+	}
+
+	if cfg.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := printReport(report, out); err != nil {
+		return err
+	}
+
+	if notReady != nil {
+		return errors.Wrapf(notReady, "cluster not ready by %s policy", cfg.Policy)
+	}
+
+	return nil
+}
+
+// printReport writes the nodes and groups of the report as tables.
+func printReport(report ready.Report, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "NODE\tINSTANCE\tGROUP\tSTATUS\tLEADER\tVERSION\tUPTIME\n")
+	for _, n := range report.Nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", n.Address, n.Instance, n.Group, n.Status, n.Leader, n.Version, time.Duration(n.Uptime)*time.Second)
+	}
+
+	fmt.Fprintf(w, "\nGROUP\tLEADER\tMEMBERS\n")
+	for _, g := range report.Groups {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", g.ID, g.Leader, strings.Join(g.Members, ", "))
+	}
+
+	return w.Flush()
+}
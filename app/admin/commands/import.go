@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/edgelist"
+	"github.com/pkg/errors"
+)
+
+// Import loads the users and follow edges from an edge list file into the
+// database. Every record that can't be loaded is reported by line number.
+func Import(log *log.Logger, gqlConfig data.GraphQLConfig, path string, source string) error {
+	if path == "" {
+		return errors.New("import: missing file, usage: import <file>")
+	}
+
+	g, err := edgelist.Open(path, source)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	failed := len(g.Errors())
+	for _, le := range g.Errors() {
+		log.Printf("import: %s: %v", path, le)
+	}
+
+	// The map tracks the database id for each source id that is stored.
+	ids := make(map[string]string)
+	users := make(map[string]feeds.User)
+
+	for _, fu := range g.Users() {
+		users[fu.SourceID] = fu
+
+		u, err := user.Add(ctx, gql, newUser(source, fu))
+		if err != nil && err != user.ErrExists {
+			log.Printf("import: %s: %v", path, edgelist.LineError{Line: g.Line(fu.SourceID), Err: err})
+			failed++
+			continue
+		}
+		ids[fu.SourceID] = u.ID
+	}
+
+	// Every follow in the file is recorded as starting when it's imported.
+	now := time.Now()
+	var edges int
+	for _, e := range g.Edges() {
+		userID, exists := ids[e.SourceID]
+		if !exists {
+			log.Printf("import: %s: %v", path, edgelist.LineError{Line: e.Line, Err: fmt.Errorf("user %q was not stored", e.SourceID)})
+			failed++
+			continue
+		}
+
+		if _, err := user.AddFriend(ctx, gql, userID, newUser(source, users[e.FriendID]), now); err != nil {
+			log.Printf("import: %s: %v", path, edgelist.LineError{Line: e.Line, Err: err})
+			failed++
+			continue
+		}
+		edges++
+	}
+
+	log.Printf("import: %s: stored %d users and %d edges", path, len(ids), edges)
+
+	if failed > 0 {
+		return fmt.Errorf("import: %d records failed", failed)
+	}
+
+	return nil
+}
+
+// newUser converts a user from a feed into the information needed to
+// store the user.
+func newUser(source string, fu feeds.User) user.NewUser {
+	return user.NewUser{
+		SourceID:     fu.SourceID,
+		Source:       source,
+		ScreenName:   fu.ScreenName,
+		Name:         fu.Name,
+		Location:     fu.Location,
+		FriendsCount: fu.FriendsCount,
+	}
+}
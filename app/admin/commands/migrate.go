@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/pkg/errors"
+)
+
+// Migrate brings the data stored by earlier versions up to date with the
+// current schema. Every step only changes the data that still needs it, so
+// it's safe to run more than once.
+func Migrate(log *log.Logger, gqlConfig data.GraphQLConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	// Users are paged in key order from here on, so every user needs a key
+	// before anything else is migrated.
+	keys, duplicates, err := user.BackfillKeys(ctx, gql)
+	if err != nil {
+		return errors.Wrap(err, "backfilling keys")
+	}
+	log.Printf("migrate: set the key of %d users stored without one", keys)
+	if duplicates > 0 {
+		log.Printf("migrate: WARNING: skipped %d duplicate users, they are left without a key", duplicates)
+	}
+
+	follows, err := user.BackfillFollows(ctx, gql, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "backfilling follows")
+	}
+	log.Printf("migrate: recorded %d follows for friends stored without one", follows)
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/foundation/rate"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Refresh re-fetches the profile and friends of every user from the
+// configured feed that was synced longer ago than staleAfter. Only the
+// follows that were added or removed since the last sync are applied. Users
+// are refreshed by the configured number of workers sharing the rate limit.
+func Refresh(log *log.Logger, gqlConfig data.GraphQLConfig, feedConfig FeedConfig, crawlConfig feeds.Config, staleAfter time.Duration, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	source, _, done, err := newSource(log, feedConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := done(); err != nil {
+			log.Printf("refresh: saving recorded interactions: %v", err)
+		}
+	}()
+
+	stale, err := user.Stale(ctx, gql, source.Name(), time.Now().Add(-staleAfter))
+	if err != nil {
+		return err
+	}
+
+	r := refresher{
+		gql:     gql,
+		source:  source,
+		limiter: rate.New(crawlConfig.Interval, crawlConfig.Burst),
+	}
+
+	workers := crawlConfig.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	users := make(chan user.User)
+	go func() {
+		defer close(users)
+		for _, u := range stale {
+			select {
+			case users <- u:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var failed int64
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for u := range users {
+				added, removed, err := r.refresh(ctx, u)
+				if err != nil {
+					log.Printf("refresh: %s user[%s]: ERROR: %v", source.Name(), u.SourceID, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				log.Printf("refresh: %s user[%s]: %d follows added, %d removed", source.Name(), u.SourceID, added, removed)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return errors.Wrapf(ctx.Err(), "refreshing %s", source.Name())
+	}
+
+	log.Printf("refresh: refreshed %d stale %s users with %d failures", len(stale)-int(failed), source.Name(), failed)
+	return nil
+}
+
+// refresher provides support for refreshing a single user.
+type refresher struct {
+	gql     *graphql.GraphQL
+	source  feeds.Source
+	limiter *rate.Limiter
+}
+
+// refresh updates the profile of the user and applies the friend delta.
+func (r *refresher) refresh(ctx context.Context, u user.User) (added int, removed int, err error) {
+	if err := r.limiter.Wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	fu, err := r.source.RetrieveUserByID(ctx, u.SourceID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "retrieving profile")
+	}
+
+	if err := r.limiter.Wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	latest, err := r.source.RetrieveFriends(ctx, u.SourceID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "retrieving friends")
+	}
+
+	friends, err := user.Friends(ctx, r.gql, u.ID)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "retrieving stored friends")
+	}
+
+	stored := make([]string, len(friends))
+	ids := make(map[string]string, len(friends))
+	for i, f := range friends {
+		stored[i] = f.SourceID
+		ids[f.SourceID] = f.ID
+	}
+
+	addedIDs, removedIDs := feeds.Delta(stored, latest)
+
+	// Follows that changed are recorded as of this sync.
+	now := time.Now()
+
+	for _, id := range addedIDs {
+		nu, err := r.newFriend(ctx, id)
+		if err != nil {
+			return added, removed, errors.Wrapf(err, "hydrating friend %s", id)
+		}
+
+		if _, err := user.AddFriend(ctx, r.gql, u.ID, nu, now); err != nil {
+			return added, removed, errors.Wrapf(err, "adding friend %s", id)
+		}
+		added++
+	}
+
+	for _, id := range removedIDs {
+		if err := user.RemoveFriend(ctx, r.gql, u.ID, ids[id], now); err != nil {
+			return added, removed, errors.Wrapf(err, "removing friend %s", id)
+		}
+		removed++
+	}
+
+	uu := user.UpdateUser{
+		ScreenName:   &fu.ScreenName,
+		Name:         &fu.Name,
+		Location:     &fu.Location,
+		FriendsCount: &fu.FriendsCount,
+		LastSynced:   &now,
+	}
+	if err := user.Update(ctx, r.gql, u.ID, uu); err != nil {
+		return added, removed, errors.Wrap(err, "updating profile")
+	}
+
+	return added, removed, nil
+}
+
+// newFriend returns the information needed to store a new friend. Friends
+// already in the database don't need to be retrieved from the source.
+func (r *refresher) newFriend(ctx context.Context, id string) (user.NewUser, error) {
+	u, err := user.OneBySourceID(ctx, r.gql, r.source.Name(), id)
+	switch err {
+	case nil:
+		return user.NewUser{SourceID: u.SourceID, Source: u.Source}, nil
+	case user.ErrNotFound:
+	default:
+		return user.NewUser{}, err
+	}
+
+	if err := r.limiter.Wait(ctx); err != nil {
+		return user.NewUser{}, err
+	}
+
+	fu, err := r.source.RetrieveUserByID(ctx, id)
+	if err != nil {
+		return user.NewUser{}, err
+	}
+
+	return newUser(r.source.Name(), fu), nil
+}
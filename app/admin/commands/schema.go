@@ -7,12 +7,22 @@ import (
 
 	"github.com/ardanlabs/dgraph/business/data"
 	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/pkg/errors"
 )
 
-// Schema handles the updating of the schema.
-func Schema(gqlConfig data.GraphQLConfig) error {
-	gql := data.NewGraphQL(gqlConfig)
-	schema := schema.New(gql)
+// Schema handles the updating of the schema. The authorization tells Dgraph
+// how to verify the tokens the @auth rules are evaluated against. Without a
+// key no update would ever be authorized, so the schema isn't changed.
+func Schema(gqlConfig data.GraphQLConfig, auth schema.Authorization) error {
+	if auth.Key == "" {
+		return errors.New("schema: missing key, set --dgraph-jwt-key to the key the @auth tokens are signed with")
+	}
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+	schema := schema.New(gql, auth)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
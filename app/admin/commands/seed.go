@@ -5,24 +5,173 @@ import (
 	"log"
 	"time"
 
-	"github.com/ardanlabs/dgraph/business/feeds/twitter"
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
 )
 
-// Seed will seed the database for a given user.
-func Seed(log *log.Logger, token string, screenName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// Seed will seed the database for a given user from the configured feed. If
+// resume is true, the crawl continues from the configured checkpoint instead
+// of starting over.
+func Seed(log *log.Logger, gqlConfig data.GraphQLConfig, feedConfig FeedConfig, crawlConfig feeds.Config, timeout time.Duration, resume bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	t := twitter.New(log, token)
-	u, err := t.RetrieveUser(ctx, screenName)
+	gql, err := data.NewGraphQL(gqlConfig)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "connecting to dgraph")
 	}
 
-	_, err = t.RetrieveFriends(ctx, u.ID)
+	source, screenName, done, err := newSource(log, feedConfig)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := done(); err != nil {
+			log.Printf("seed: saving recorded interactions: %v", err)
+		}
+	}()
+
+	// Users are only recorded as visited by the crawl once they are stored,
+	// so the ones that fail are crawled again when the seed is resumed.
+	crawlConfig.Acknowledge = true
+	crawler := feeds.NewCrawler(source, crawlConfig)
+
+	var results <-chan feeds.Result
+	switch {
+	case resume:
+		if crawlConfig.Checkpoint == "" {
+			return errors.New("resuming requires a checkpoint file")
+		}
+
+		cp, err := feeds.LoadCheckpoint(crawlConfig.Checkpoint)
+		if err != nil {
+			return err
+		}
+		log.Printf("seed: resuming %s crawl of %s at level %d with %d tasks left", cp.Source, cp.Root.ScreenName, cp.Depth, len(cp.Frontier))
+
+		// The crawl continues with the levels it was started with.
+		crawlConfig.Levels = cp.Levels
+		if results, err = crawler.Resume(ctx, cp); err != nil {
+			return err
+		}
+
+	default:
+		root, err := source.RetrieveUser(ctx, screenName)
+		if err != nil {
+			return err
+		}
+		results = crawler.Crawl(ctx, root)
+	}
+
+	// Results are stored as they arrive from the crawler. The map tracks
+	// the database id for each source id that has been stored.
+	ids := make(map[string]string)
+	var failed, unstored int
+
+	for result := range results {
+		if result.Err != nil {
+			log.Printf("seed: %s user[%s]: ERROR: %v", source.Name(), result.User.SourceID, result.Err)
+			failed++
+			continue
+		}
+
+		// Users that are expanded by the crawler have their friends synced.
+		now := time.Now()
+		var synced time.Time
+		if result.Level < crawlConfig.Levels {
+			synced = now
+		}
+
+		err := store(ctx, gql, source.Name(), ids, result, now, synced)
+		crawler.Ack(err)
+		if err != nil {
+			log.Printf("seed: %s user[%s]: ERROR: %v", source.Name(), result.User.SourceID, err)
+			failed++
+			unstored++
+		}
+	}
+
+	// The checkpoint can only be resumed from if it was saved.
+	resumable := crawlConfig.Checkpoint != ""
+	if err := crawler.Err(); err != nil {
+		log.Printf("seed: %s: ERROR: %v", crawlConfig.Checkpoint, err)
+		resumable = false
+	}
+
+	if ctx.Err() != nil {
+		if resumable {
+			return errors.Wrapf(ctx.Err(), "crawling %s, run seed --resume to continue", source.Name())
+		}
+		return errors.Wrapf(ctx.Err(), "crawling %s", source.Name())
+	}
+
+	log.Printf("seed: stored %d %s users with %d failures", len(ids), source.Name(), failed)
+	if unstored > 0 && resumable {
+		log.Printf("seed: run seed --resume to retry the %d users that were not stored", unstored)
+	}
+
+	return nil
+}
+
+// store persists the crawled user and the edges from each of its followers.
+// The follows are recorded as starting at the time the user was crawled. A
+// user that was stored by an earlier seed is marked as synced again when its
+// friends were crawled.
+func store(ctx context.Context, gql *graphql.GraphQL, source string, ids map[string]string, result feeds.Result, crawled time.Time, synced time.Time) error {
+	nu := newUser(source, result.User)
+	nu.LastSynced = synced
+
+	if len(result.Followers) == 0 {
+		u, err := user.Add(ctx, gql, nu)
+		if err != nil && err != user.ErrExists {
+			return err
+		}
+		ids[result.User.SourceID] = u.ID
+		return markSynced(ctx, gql, u, synced)
+	}
+
+	for _, followerID := range result.Followers {
+
+		// A resumed crawl has followers that were stored by the run
+		// that was interrupted.
+		userID, exists := ids[followerID]
+		if !exists {
+			u, err := user.OneBySourceID(ctx, gql, source, followerID)
+			if err != nil {
+				return errors.Wrapf(err, "follower %s was not stored", followerID)
+			}
+			userID = u.ID
+			ids[followerID] = userID
+		}
+
+		u, err := user.AddFriend(ctx, gql, userID, nu, crawled)
+		if err != nil {
+			return err
+		}
+		ids[result.User.SourceID] = u.ID
+
+		if err := markSynced(ctx, gql, u, synced); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markSynced records the time the friends of an existing user were synced.
+// Users added by the seed already carry the time.
+func markSynced(ctx context.Context, gql *graphql.GraphQL, u user.User, synced time.Time) error {
+	synced = synced.UTC().Truncate(time.Second)
+	if synced.IsZero() || u.LastSynced.Equal(synced) {
+		return nil
+	}
+
+	if err := user.Update(ctx, gql, u.ID, user.UpdateUser{LastSynced: &synced}); err != nil {
+		return errors.Wrap(err, "marking user synced")
+	}
 
 	return nil
 }
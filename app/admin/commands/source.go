@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/edgelist"
+	"github.com/ardanlabs/dgraph/business/feeds/github"
+	"github.com/ardanlabs/dgraph/business/feeds/mastodon"
+	"github.com/ardanlabs/dgraph/business/feeds/twitter"
+	"github.com/ardanlabs/dgraph/foundation/cassette"
+)
+
+// FeedConfig represents the feed provider to use and the settings needed
+// to access each of the supported providers.
+type FeedConfig struct {
+	Source   string
+	Twitter  TwitterConfig
+	Mastodon MastodonConfig
+	GitHub   GitHubConfig
+	File     FileConfig
+}
+
+// TwitterConfig represents the credentials needed to access twitter. If an
+// API key and secret are provided, the bearer token is obtained from twitter.
+// If a cassette is provided, the requests made to twitter are recorded to it
+// or replayed from it based on the cassette mode.
+type TwitterConfig struct {
+	ScreenName   string
+	Token        string
+	APIKey       string
+	SecretKey    string
+	Cassette     string
+	CassetteMode string
+}
+
+// MastodonConfig represents the server and credentials needed to access
+// a mastodon server.
+type MastodonConfig struct {
+	Account string
+	URL     string
+	Token   string
+}
+
+// GitHubConfig represents the credentials needed to access github.
+type GitHubConfig struct {
+	Login string
+	Token string
+}
+
+// FileConfig represents an edge list file to use as a feed. The source
+// is the name of the network the users were exported from.
+type FileConfig struct {
+	Path       string
+	ScreenName string
+	Source     string
+}
+
+// newSource constructs the configured feed provider. It also returns the
+// account configured to start crawling from and a function that must be
+// called once the provider is no longer used, which saves the interactions
+// recorded by a cassette.
+func newSource(log *log.Logger, cfg FeedConfig) (feeds.Source, string, func() error, error) {
+	done := func() error { return nil }
+
+	switch cfg.Source {
+	case "twitter":
+		var options []func(t *twitter.Twitter)
+		if cfg.Twitter.Cassette != "" {
+			transport, err := cassette.New(cfg.Twitter.Cassette, cfg.Twitter.CassetteMode, nil)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			options = append(options, twitter.WithTransport(transport))
+			done = transport.Close
+		}
+
+		if cfg.Twitter.APIKey != "" {
+			return twitter.NewWithKeys(log, cfg.Twitter.APIKey, cfg.Twitter.SecretKey, options...), cfg.Twitter.ScreenName, done, nil
+		}
+		return twitter.New(log, cfg.Twitter.Token, options...), cfg.Twitter.ScreenName, done, nil
+
+	case "mastodon":
+		return mastodon.New(log, cfg.Mastodon.URL, cfg.Mastodon.Token), cfg.Mastodon.Account, done, nil
+
+	case "github":
+		return github.New(log, cfg.GitHub.Token), cfg.GitHub.Login, done, nil
+
+	case "file":
+		g, err := edgelist.Open(cfg.File.Path, cfg.File.Source)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		for _, le := range g.Errors() {
+			log.Printf("feed: %s: %v", cfg.File.Path, le)
+		}
+		return g, cfg.File.ScreenName, done, nil
+	}
+
+	return nil, "", nil, fmt.Errorf("unknown feed source %q", cfg.Source)
+}
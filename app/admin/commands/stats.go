@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/stats"
+	"github.com/pkg/errors"
+)
+
+// Stats reports a summary of the graph stored in the database as a set of
+// tables or as JSON.
+func Stats(gqlConfig data.GraphQLConfig, cfg stats.Config, asJSON bool, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	gql, err := data.NewGraphQL(gqlConfig)
+	if err != nil {
+		return errors.Wrap(err, "connecting to dgraph")
+	}
+
+	s, err := stats.Retrieve(ctx, gql, cfg)
+	if err != nil {
+		return errors.Wrap(err, "retrieving stats")
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "USERS\t%d\n", s.Users)
+	sources := make([]string, 0, len(s.BySource))
+	for source := range s.BySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(w, "  %s\t%d\n", source, s.BySource[source])
+	}
+	fmt.Fprintf(w, "FRIEND EDGES\t%d\n", s.Edges)
+	fmt.Fprintf(w, "ISOLATED\t%d\n", s.Isolated)
+
+	fmt.Fprintf(w, "\nDEGREE\tIN\tOUT\n")
+	for i := 0; i < len(s.InDegree) || i < len(s.OutDegree); i++ {
+		var label string
+		var in, out int
+		if i < len(s.InDegree) {
+			label = bucketLabel(s.InDegree[i])
+			in = s.InDegree[i].Users
+		}
+		if i < len(s.OutDegree) {
+			label = bucketLabel(s.OutDegree[i])
+			out = s.OutDegree[i].Users
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", label, in, out)
+	}
+
+	fmt.Fprintf(w, "\nTOP IN-DEGREE\tSOURCE\tFOLLOWERS\n")
+	for _, a := range s.TopIn {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", a.ScreenName, a.Source, a.Degree)
+	}
+
+	fmt.Fprintf(w, "\nTOP OUT-DEGREE\tSOURCE\tFRIENDS\n")
+	for _, a := range s.TopOut {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", a.ScreenName, a.Source, a.Degree)
+	}
+
+	fmt.Fprintf(w, "\nPARTIALLY CRAWLED\tSOURCE\tFRIENDS COUNT\tSTORED\tMISSING\n")
+	for _, a := range s.Partial {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", a.ScreenName, a.Source, a.FriendsCount, a.Stored, a.Missing)
+	}
+
+	return w.Flush()
+}
+
+// bucketLabel returns the degree range of a histogram bucket.
+func bucketLabel(b stats.Bucket) string {
+	if b.Min == b.Max {
+		return fmt.Sprint(b.Min)
+	}
+	return fmt.Sprintf("%d-%d", b.Min, b.Max)
+}
@@ -2,13 +2,21 @@ package main
 
 import (
 	"expvar"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/ardanlabs/conf"
 	"github.com/ardanlabs/dgraph/app/admin/commands"
+	"github.com/ardanlabs/dgraph/business/analytics"
 	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/ardanlabs/dgraph/business/data/stats"
+	"github.com/ardanlabs/dgraph/business/export"
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/foundation/trace"
 	"github.com/pkg/errors"
 )
 
@@ -36,12 +44,80 @@ func run(log *log.Logger) error {
 		Args   conf.Args
 		Dgraph struct {
 			URL            string `conf:"default:http://0.0.0.0:8080"`
+			ZeroURL        string `conf:"default:http://0.0.0.0:6080,help:zero http endpoint the health command reads groups and leaders from"`
 			AuthHeaderName string `conf:"default:X-Travel-Auth"`
 			AuthToken      string
+			Protected      bool `conf:"help:refuse to drop anything from this database"`
+			Retry          struct {
+				Attempts   int           `conf:"default:8,help:times a failed query is retried"`
+				Backoff    time.Duration `conf:"default:250ms"`
+				MaxBackoff time.Duration `conf:"default:4s"`
+				Threshold  int           `conf:"default:5,help:failed requests in a row before failing fast"`
+				Cooldown   time.Duration `conf:"default:30s"`
+			}
+			JWT struct {
+				Key       string        `conf:"noprint,help:key the tokens for the @auth rules are signed with, required by the schema command"`
+				Namespace string        `conf:"default:https://dgraph.io/jwt/claims"`
+				TTL       time.Duration `conf:"default:5m"`
+			}
+			ACL struct {
+				User          string
+				Password      string        `conf:"noprint"`
+				Namespace     int           `conf:"help:namespace to log in to on multi-tenant clusters"`
+				RefreshBefore time.Duration `conf:"default:30s,help:how long before expiry the access token is refreshed"`
+			}
+			TLS struct {
+				CAFile             string `conf:"help:pem bundle used to verify the server"`
+				CertFile           string `conf:"help:client certificate for mutual tls"`
+				KeyFile            string `conf:"help:client key for mutual tls"`
+				ServerName         string
+				InsecureSkipVerify bool `conf:"help:development only"`
+			}
+			LogQueries bool     `conf:"help:log every request made to dgraph"`
+			Trace      string   `conf:"help:stdout or a file to write a span for every request to"`
+			Redact     []string `conf:"help:variables never logged or traced, * for all"`
+		}
+		Feed struct {
+			Source string `conf:"default:twitter,help:feed provider to crawl: twitter, mastodon, github or file"`
 		}
 		Twitter struct {
-			ScreenName string `conf:"default:goinggodotnet"`
-			Token      string `conf:"noprint"`
+			ScreenName   string `conf:"default:goinggodotnet"`
+			Token        string `conf:"noprint"`
+			APIKey       string `conf:"noprint"`
+			SecretKey    string `conf:"noprint"`
+			Cassette     string `conf:"help:file to record twitter requests to or replay them from"`
+			CassetteMode string `conf:"default:replay,help:cassette mode: record or replay"`
+		}
+		Mastodon struct {
+			Account string `conf:"default:Gargron"`
+			URL     string `conf:"default:https://mastodon.social"`
+			Token   string `conf:"noprint"`
+		}
+		GitHub struct {
+			Login string `conf:"default:goinggo"`
+			Token string `conf:"noprint"`
+		}
+		File struct {
+			Path       string
+			ScreenName string
+			Source     string `conf:"default:twitter"`
+		}
+		Refresh struct {
+			StaleAfter time.Duration `conf:"default:24h"`
+			Timeout    time.Duration `conf:"default:5m"`
+		}
+		Analyze struct {
+			Damping float64 `conf:"default:0.85"`
+			Samples int     `conf:"default:500,help:sources used to estimate betweenness, 0 for exact"`
+			Top     int     `conf:"default:20"`
+		}
+		Crawl struct {
+			Workers    int           `conf:"default:4"`
+			Levels     int           `conf:"default:1"`
+			Interval   time.Duration `conf:"default:1s"`
+			Burst      int           `conf:"default:15"`
+			Timeout    time.Duration `conf:"default:30s"`
+			Checkpoint string        `conf:"default:seed.checkpoint,help:file the state of a seed crawl is saved to so it can be resumed"`
 		}
 	}
 	cfg.Version.SVN = build
@@ -82,6 +158,42 @@ func run(log *log.Logger) error {
 	}
 	log.Printf("main: Config:\n%v\n", out)
 
+	// =========================================================================
+	// Instrumentation
+
+	instrument := data.InstrumentConfig{
+		Redact: cfg.Dgraph.Redact,
+	}
+	if cfg.Dgraph.LogQueries {
+		instrument.Log = log
+	}
+
+	switch cfg.Dgraph.Trace {
+	case "":
+	case "stdout":
+		instrument.Tracer = trace.New(trace.NewJSONExporter(os.Stdout))
+	default:
+		f, err := os.OpenFile(cfg.Dgraph.Trace, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Wrap(err, "opening trace file")
+		}
+		defer f.Close()
+		instrument.Tracer = trace.New(trace.NewJSONExporter(f))
+	}
+
+	// The admin tool acts on every user, so it signs its requests as an
+	// admin and tells Dgraph how to verify them. Without a key nothing is
+	// signed and the schema can't be updated.
+	schemaAuth := schema.Authorization{
+		Header:    cfg.Dgraph.AuthHeaderName,
+		Namespace: cfg.Dgraph.JWT.Namespace,
+		Key:       cfg.Dgraph.JWT.Key,
+	}
+	var signer *data.Signer
+	if cfg.Dgraph.JWT.Key != "" {
+		signer = data.NewSigner(cfg.Dgraph.JWT.Key, cfg.Dgraph.JWT.Namespace, cfg.Dgraph.JWT.TTL)
+	}
+
 	// =========================================================================
 	// Commands
 
@@ -89,21 +201,207 @@ func run(log *log.Logger) error {
 		URL:            cfg.Dgraph.URL,
 		AuthHeaderName: cfg.Dgraph.AuthHeaderName,
 		AuthToken:      cfg.Dgraph.AuthToken,
+		Signer:         signer,
+		Claims:         data.Claims{Role: data.RoleAdmin},
+		ACL: data.ACLConfig{
+			User:          cfg.Dgraph.ACL.User,
+			Password:      cfg.Dgraph.ACL.Password,
+			Namespace:     cfg.Dgraph.ACL.Namespace,
+			RefreshBefore: cfg.Dgraph.ACL.RefreshBefore,
+		},
+		Retry: data.RetryConfig{
+			Attempts:   cfg.Dgraph.Retry.Attempts,
+			Backoff:    cfg.Dgraph.Retry.Backoff,
+			MaxBackoff: cfg.Dgraph.Retry.MaxBackoff,
+			Threshold:  cfg.Dgraph.Retry.Threshold,
+			Cooldown:   cfg.Dgraph.Retry.Cooldown,
+		},
+		Instrument: instrument,
+		TLS: data.TLSConfig{
+			CAFile:             cfg.Dgraph.TLS.CAFile,
+			CertFile:           cfg.Dgraph.TLS.CertFile,
+			KeyFile:            cfg.Dgraph.TLS.KeyFile,
+			ServerName:         cfg.Dgraph.TLS.ServerName,
+			InsecureSkipVerify: cfg.Dgraph.TLS.InsecureSkipVerify,
+		},
+	}
+
+	feedConfig := commands.FeedConfig{
+		Source: cfg.Feed.Source,
+		Twitter: commands.TwitterConfig{
+			ScreenName:   cfg.Twitter.ScreenName,
+			Token:        cfg.Twitter.Token,
+			APIKey:       cfg.Twitter.APIKey,
+			SecretKey:    cfg.Twitter.SecretKey,
+			Cassette:     cfg.Twitter.Cassette,
+			CassetteMode: cfg.Twitter.CassetteMode,
+		},
+		Mastodon: commands.MastodonConfig{
+			Account: cfg.Mastodon.Account,
+			URL:     cfg.Mastodon.URL,
+			Token:   cfg.Mastodon.Token,
+		},
+		GitHub: commands.GitHubConfig{
+			Login: cfg.GitHub.Login,
+			Token: cfg.GitHub.Token,
+		},
+		File: commands.FileConfig{
+			Path:       cfg.File.Path,
+			ScreenName: cfg.File.ScreenName,
+			Source:     cfg.File.Source,
+		},
+	}
+
+	crawlConfig := feeds.Config{
+		Workers:  cfg.Crawl.Workers,
+		Levels:   cfg.Crawl.Levels,
+		Interval: cfg.Crawl.Interval,
+		Burst:    cfg.Crawl.Burst,
+	}
+
+	// Flags that follow the command only apply to that command.
+	var args []string
+	if len(cfg.Args) > 1 {
+		args = cfg.Args[1:]
 	}
 
 	switch cfg.Args.Num(0) {
 	case "schema":
-		if err := commands.Schema(gqlConfig); err != nil {
+		if err := commands.Schema(gqlConfig, schemaAuth); err != nil {
 			return errors.Wrap(err, "updating schema")
 		}
 
+	case "migrate":
+		if err := commands.Migrate(log, gqlConfig); err != nil {
+			return errors.Wrap(err, "migrating database")
+		}
+
 	case "seed":
-		if err := commands.Seed(log, cfg.Twitter.Token, cfg.Twitter.ScreenName); err != nil {
+		fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+		resume := fs.Bool("resume", false, "continue the crawl saved in the checkpoint file")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "parsing seed flags")
+		}
+
+		crawlConfig.Checkpoint = cfg.Crawl.Checkpoint
+		if err := commands.Seed(log, gqlConfig, feedConfig, crawlConfig, cfg.Crawl.Timeout, *resume); err != nil {
 			return errors.Wrap(err, "seeding database")
 		}
 
+	case "refresh":
+		if err := commands.Refresh(log, gqlConfig, feedConfig, crawlConfig, cfg.Refresh.StaleAfter, cfg.Refresh.Timeout); err != nil {
+			return errors.Wrap(err, "refreshing database")
+		}
+
+	case "import":
+		if err := commands.Import(log, gqlConfig, cfg.Args.Num(1), cfg.File.Source); err != nil {
+			return errors.Wrap(err, "importing edge list")
+		}
+
+	case "backup":
+		if err := commands.Backup(log, gqlConfig, cfg.Args.Num(1)); err != nil {
+			return errors.Wrap(err, "backing up database")
+		}
+
+	case "restore":
+		if err := commands.Restore(log, gqlConfig, cfg.Args.Num(1)); err != nil {
+			return errors.Wrap(err, "restoring database")
+		}
+
+	case "drop":
+		fs := flag.NewFlagSet("drop", flag.ContinueOnError)
+		yes := fs.Bool("yes", false, "skip the typed confirmation")
+		backup := fs.String("backup", "", "write a backup to this file before dropping")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "parsing drop flags")
+		}
+
+		dropConfig := commands.DropConfig{
+			What:      fs.Arg(0),
+			Yes:       *yes,
+			Protected: cfg.Dgraph.Protected,
+			Backup:    *backup,
+		}
+		if err := commands.Drop(log, gqlConfig, dropConfig, os.Stdin, os.Stdout); err != nil {
+			return errors.Wrap(err, "dropping database")
+		}
+
+	case "analyze":
+		analyzeConfig := analytics.Config{
+			Damping: cfg.Analyze.Damping,
+			Samples: cfg.Analyze.Samples,
+			Seed:    time.Now().UnixNano(),
+		}
+		if err := commands.Analyze(log, gqlConfig, analyzeConfig, cfg.Analyze.Top); err != nil {
+			return errors.Wrap(err, "analyzing graph")
+		}
+
+	case "stats":
+		fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+		asJSON := fs.Bool("json", false, "write the stats as json")
+		top := fs.Int("top", 10, "number of accounts to list by degree")
+		minMissing := fs.Int("min-missing", 10, "friends missing for an account to be partially crawled")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "parsing stats flags")
+		}
+
+		statsConfig := stats.Config{
+			Top:        *top,
+			MinMissing: *minMissing,
+		}
+		if err := commands.Stats(gqlConfig, statsConfig, *asJSON, os.Stdout); err != nil {
+			return errors.Wrap(err, "reporting stats")
+		}
+
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ContinueOnError)
+		format := fs.String("format", "", "graphml, gexf, dot or rdf, defaults to the file extension")
+		ego := fs.String("ego", "", "only export the network of the user with this screen name")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "parsing export flags")
+		}
+
+		exportConfig := export.Config{
+			Format: *format,
+			Ego:    *ego,
+		}
+		if err := commands.Export(log, gqlConfig, fs.Arg(0), exportConfig); err != nil {
+			return errors.Wrap(err, "exporting graph")
+		}
+
+	case "health":
+		fs := flag.NewFlagSet("health", flag.ContinueOnError)
+		policy := fs.String("policy", "all", "all for every alpha healthy or quorum for a majority of every group")
+		wait := fs.Duration("wait", 0, "keep checking until the cluster is ready or this much time passed")
+		asJSON := fs.Bool("json", false, "write the report as json")
+		if err := fs.Parse(args); err != nil {
+			return errors.Wrap(err, "parsing health flags")
+		}
+
+		healthConfig := commands.HealthConfig{
+			ZeroURL: cfg.Dgraph.ZeroURL,
+			Policy:  *policy,
+			Wait:    *wait,
+			JSON:    *asJSON,
+		}
+		if err := commands.Health(gqlConfig, healthConfig, os.Stdout); err != nil {
+			return errors.Wrap(err, "checking cluster health")
+		}
+
 	default:
 		fmt.Println("schema: update the schema in the database")
+		fmt.Println("migrate: bring data stored by earlier versions up to date")
+		fmt.Println("seed: crawl a feed and store the friends of an account")
+		fmt.Println("seed --resume: continue an interrupted seed from its checkpoint")
+		fmt.Println("refresh: re-sync the profile and friends of stale users")
+		fmt.Println("import: load users and follow edges from a csv or jsonl file")
+		fmt.Println("export: write the graph to a graphml, gexf, dot or rdf file")
+		fmt.Println("backup: dump every user and friend edge to a jsonl file")
+		fmt.Println("restore: load a backup file into the database")
+		fmt.Println("stats: summarize the users and friend edges stored")
+		fmt.Println("analyze: rank and cluster the users and store their scores")
+		fmt.Println("drop: remove all the data, or the data and schema, after confirmation")
+		fmt.Println("health: report the health of every zero and alpha in the cluster")
 		return commands.ErrHelp
 	}
 
@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Config represents the settings for analyzing the graph. Samples is the
+// number of sources used to estimate betweenness, where 0 computes it
+// exactly.
+type Config struct {
+	Damping    float64
+	Tolerance  float64
+	Iterations int
+	Samples    int
+	Seed       int64
+}
+
+// Score represents the results of the analysis for a single user.
+type Score struct {
+	ID          string
+	PageRank    float64
+	InDegree    int
+	OutDegree   int
+	Betweenness float64
+	Community   int
+}
+
+// Analyze computes the scores for every user in the graph. The scores are
+// returned from the highest pagerank to the lowest.
+func Analyze(g *Graph, cfg Config) []Score {
+	if cfg.Damping <= 0 || cfg.Damping >= 1 {
+		cfg.Damping = 0.85
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 1e-9
+	}
+	if cfg.Iterations <= 0 {
+		cfg.Iterations = 100
+	}
+
+	rank := PageRank(g, cfg.Damping, cfg.Tolerance, cfg.Iterations)
+	betweenness := Betweenness(g, cfg.Samples, cfg.Seed)
+	communities := Communities(g)
+
+	scores := make([]Score, g.Len())
+	for i := range scores {
+		scores[i] = Score{
+			ID:          g.ID(i),
+			PageRank:    rank[i],
+			InDegree:    g.InDegree(i),
+			OutDegree:   g.OutDegree(i),
+			Betweenness: betweenness[i],
+			Community:   communities[i],
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].PageRank > scores[j].PageRank
+	})
+
+	return scores
+}
+
+// saveBatch is the number of users updated in each request by Save.
+const saveBatch = 100
+
+// Save writes the scores back to the users in the database. The users are
+// updated in batches to keep the number of requests down on large graphs.
+func Save(ctx context.Context, gql *graphql.GraphQL, scores []Score) error {
+	for start := 0; start < len(scores); start += saveBatch {
+		end := start + saveBatch
+		if end > len(scores) {
+			end = len(scores)
+		}
+
+		updates := make(map[string]user.UpdateUser, end-start)
+		for _, s := range scores[start:end] {
+			s := s
+			updates[s.ID] = user.UpdateUser{
+				PageRank:    &s.PageRank,
+				InDegree:    &s.InDegree,
+				OutDegree:   &s.OutDegree,
+				Betweenness: &s.Betweenness,
+				Community:   &s.Community,
+			}
+		}
+
+		if err := user.UpdateMany(ctx, gql, updates); err != nil {
+			return errors.Wrapf(err, "saving scores for users %d to %d", start, end)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package analytics_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/analytics"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestAnalytics validates the graph algorithms against graphs with known
+// answers.
+func TestAnalytics(t *testing.T) {
+	t.Run("pagerank", pagerank)
+	t.Run("betweenness", betweenness)
+	t.Run("communities", communities)
+}
+
+// cliques constructs two groups of users where everyone in a group follows
+// everyone else in it, joined by a single follow between a0 and b0.
+func cliques(size int) *analytics.Graph {
+	var ids []string
+	var edges [][2]string
+
+	for _, group := range []string{"a", "b"} {
+		for i := 0; i < size; i++ {
+			ids = append(ids, fmt.Sprintf("%s%d", group, i))
+			for j := 0; j < size; j++ {
+				if i != j {
+					edges = append(edges, [2]string{fmt.Sprintf("%s%d", group, i), fmt.Sprintf("%s%d", group, j)})
+				}
+			}
+		}
+	}
+	edges = append(edges, [2]string{"a0", "b0"})
+
+	return analytics.NewGraph(ids, edges)
+}
+
+// pagerank validates the most followed user ranks highest.
+func pagerank(t *testing.T) {
+	t.Log("Given the need to rank users by influence.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen everyone follows the same user.", testID)
+		{
+			ids := []string{"hub", "u1", "u2", "u3", "u4"}
+			edges := [][2]string{{"u1", "hub"}, {"u2", "hub"}, {"u3", "hub"}, {"u4", "hub"}, {"hub", "u1"}}
+			g := analytics.NewGraph(ids, edges)
+
+			rank := analytics.PageRank(g, 0.85, 1e-12, 200)
+
+			var sum float64
+			for _, r := range rank {
+				sum += r
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Fatalf("\t%s\tTest %d:\tShould have ranks that sum to 1, got %f.", tests.Failed, testID, sum)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have ranks that sum to 1.", tests.Success, testID)
+
+			for i := 1; i < len(rank); i++ {
+				if rank[0] <= rank[i] {
+					t.Fatalf("\t%s\tTest %d:\tShould rank the hub highest: %v", tests.Failed, testID, rank)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould rank the hub highest.", tests.Success, testID)
+
+			if rank[1] <= rank[2] {
+				t.Fatalf("\t%s\tTest %d:\tShould rank the user the hub follows above the others: %v", tests.Failed, testID, rank)
+			}
+			t.Logf("\t%s\tTest %d:\tShould rank the user the hub follows above the others.", tests.Success, testID)
+		}
+	}
+}
+
+// betweenness validates the users that bridge the graph score highest and
+// that sampling estimates the exact value.
+func betweenness(t *testing.T) {
+	t.Log("Given the need to find the users that bridge the network.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen users follow each other in a line.", testID)
+		{
+			g := analytics.NewGraph([]string{"a", "b", "c", "d"}, [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}})
+
+			exp := []float64{0, 2, 2, 0}
+			got := analytics.Betweenness(g, 0, 0)
+			for i := range exp {
+				if got[i] != exp[i] {
+					t.Fatalf("\t%s\tTest %d:\tShould count the paths through each user, exp %v got %v.", tests.Failed, testID, exp, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the paths through each user.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen two groups are joined by a single follow.", testID)
+		{
+			g := cliques(20)
+
+			exact := analytics.Betweenness(g, 0, 0)
+			sampled := analytics.Betweenness(g, 20, 1)
+
+			top := func(scores []float64) int {
+				var best int
+				for i := range scores {
+					if scores[i] > scores[best] {
+						best = i
+					}
+				}
+				return best
+			}
+
+			if g.ID(top(exact)) != "a0" && g.ID(top(exact)) != "b0" {
+				t.Fatalf("\t%s\tTest %d:\tShould score a bridge user highest, got %s.", tests.Failed, testID, g.ID(top(exact)))
+			}
+			t.Logf("\t%s\tTest %d:\tShould score a bridge user highest.", tests.Success, testID)
+
+			if g.ID(top(sampled)) != "a0" && g.ID(top(sampled)) != "b0" {
+				t.Fatalf("\t%s\tTest %d:\tShould score a bridge user highest when sampling, got %s.", tests.Failed, testID, g.ID(top(sampled)))
+			}
+			t.Logf("\t%s\tTest %d:\tShould score a bridge user highest when sampling.", tests.Success, testID)
+		}
+	}
+}
+
+// communities validates tightly connected groups end up in the same
+// community.
+func communities(t *testing.T) {
+	t.Log("Given the need to find groups of users that follow each other.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen two groups are joined by a single follow.", testID)
+		{
+			g := cliques(5)
+			got := analytics.Communities(g)
+
+			for i := 0; i < 5; i++ {
+				if got[i] != got[0] || got[5+i] != got[5] {
+					t.Fatalf("\t%s\tTest %d:\tShould put each group in one community: %v", tests.Failed, testID, got)
+				}
+			}
+			if got[0] == got[5] {
+				t.Fatalf("\t%s\tTest %d:\tShould put the groups in different communities: %v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould put each group in its own community.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen users don't follow anyone.", testID)
+		{
+			g := analytics.NewGraph([]string{"a", "b"}, nil)
+			got := analytics.Communities(g)
+
+			if len(got) != 2 || got[0] == got[1] {
+				t.Fatalf("\t%s\tTest %d:\tShould put each user in its own community: %v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould put each user in its own community.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package analytics provides support for ranking and clustering the users in
+// the follow graph. The graph is loaded into memory once and every algorithm
+// works on the same adjacency lists.
+package analytics
+
+import (
+	"context"
+
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Graph represents the follow graph as adjacency lists. Nodes are indexed
+// from 0 and an edge from a to b means user a follows user b.
+type Graph struct {
+	ids   []string
+	index map[string]int
+	out   [][]int
+	in    [][]int
+}
+
+// NewGraph constructs a graph for the specified users and edges. Edges that
+// reference unknown users and duplicate edges are ignored.
+func NewGraph(ids []string, edges [][2]string) *Graph {
+	g := Graph{
+		ids:   ids,
+		index: make(map[string]int, len(ids)),
+		out:   make([][]int, len(ids)),
+		in:    make([][]int, len(ids)),
+	}
+	for i, id := range ids {
+		g.index[id] = i
+	}
+
+	seen := make(map[[2]int]bool, len(edges))
+	for _, e := range edges {
+		from, ok := g.index[e[0]]
+		if !ok {
+			continue
+		}
+		to, ok := g.index[e[1]]
+		if !ok || from == to {
+			continue
+		}
+
+		key := [2]int{from, to}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		g.out[from] = append(g.out[from], to)
+		g.in[to] = append(g.in[to], from)
+	}
+
+	return &g
+}
+
+// Load reads every user and friend edge from the database one page at a
+// time and constructs the graph.
+func Load(ctx context.Context, gql *graphql.GraphQL, pageSize int) (*Graph, error) {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+
+	var ids []string
+	var edges [][2]string
+
+	for offset := 0; ; offset += pageSize {
+		users, err := user.List(ctx, gql, offset, pageSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "listing users at offset %d", offset)
+		}
+
+		for _, u := range users {
+			ids = append(ids, u.ID)
+			for _, f := range u.Friends {
+				edges = append(edges, [2]string{u.ID, f.ID})
+			}
+		}
+
+		if len(users) < pageSize {
+			break
+		}
+	}
+
+	return NewGraph(ids, edges), nil
+}
+
+// Len returns the number of nodes in the graph.
+func (g *Graph) Len() int {
+	return len(g.ids)
+}
+
+// ID returns the database id of the specified node.
+func (g *Graph) ID(node int) string {
+	return g.ids[node]
+}
+
+// InDegree returns the number of followers of the specified node.
+func (g *Graph) InDegree(node int) int {
+	return len(g.in[node])
+}
+
+// OutDegree returns the number of friends of the specified node.
+func (g *Graph) OutDegree(node int) int {
+	return len(g.out[node])
+}
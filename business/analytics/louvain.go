@@ -0,0 +1,163 @@
+package analytics
+
+import "sort"
+
+// epsilon is the smallest gain in modularity worth moving a node for. It
+// keeps rounding errors from moving nodes back and forth forever.
+const epsilon = 1e-12
+
+// Communities returns the community of every node using the Louvain method.
+// Follows are treated as undirected ties, weighted by the number of
+// directions they exist in. Communities are numbered from 0 in the order
+// their first node appears in the graph.
+func Communities(g *Graph) []int {
+	n := g.Len()
+
+	// The weights form a symmetric matrix. Ties inside a community become
+	// the diagonal once communities are merged into single nodes.
+	adj := make([]map[int]float64, n)
+	for i := range adj {
+		adj[i] = make(map[int]float64)
+	}
+	for i := range g.out {
+		for _, j := range g.out[i] {
+			adj[i][j]++
+			adj[j][i]++
+		}
+	}
+
+	// The community each original node belongs to.
+	membership := make([]int, n)
+	for i := range membership {
+		membership[i] = i
+	}
+
+	for {
+		community, moved := modularity(adj)
+		if !moved {
+			break
+		}
+
+		community, count := renumber(community)
+		for i := range membership {
+			membership[i] = community[membership[i]]
+		}
+
+		adj = merge(adj, community, count)
+	}
+
+	membership, _ = renumber(membership)
+	return membership
+}
+
+// =============================================================================
+
+// modularity moves every node to the neighboring community that increases
+// modularity the most, until no move increases it. It reports if any node
+// was moved.
+func modularity(adj []map[int]float64) ([]int, bool) {
+	n := len(adj)
+
+	var total float64
+	degree := make([]float64, n)
+	for i := range adj {
+		for _, w := range adj[i] {
+			degree[i] += w
+		}
+		total += degree[i]
+	}
+
+	community := make([]int, n)
+	sum := make([]float64, n)
+	for i := range community {
+		community[i] = i
+		sum[i] = degree[i]
+	}
+
+	if total == 0 {
+		return community, false
+	}
+
+	var moved bool
+	weights := make(map[int]float64)
+	var candidates []int
+
+	for improved := true; improved; {
+		improved = false
+
+		for i := 0; i < n; i++ {
+			current := community[i]
+
+			for c := range weights {
+				delete(weights, c)
+			}
+			for j, w := range adj[i] {
+				if j != i {
+					weights[community[j]] += w
+				}
+			}
+
+			// Take the node out of its community and put it back in the
+			// community with the best gain. Ties keep the node where it is
+			// or go to the lowest community so the result is repeatable.
+			sum[current] -= degree[i]
+
+			candidates = candidates[:0]
+			for c := range weights {
+				candidates = append(candidates, c)
+			}
+			sort.Ints(candidates)
+
+			best := current
+			bestGain := weights[current] - sum[current]*degree[i]/total
+			for _, c := range candidates {
+				gain := weights[c] - sum[c]*degree[i]/total
+				if gain > bestGain+epsilon {
+					best = c
+					bestGain = gain
+				}
+			}
+
+			sum[best] += degree[i]
+			community[i] = best
+
+			if best != current {
+				improved = true
+				moved = true
+			}
+		}
+	}
+
+	return community, moved
+}
+
+// renumber numbers the communities from 0 in order of first appearance.
+func renumber(community []int) ([]int, int) {
+	ids := make(map[int]int)
+	out := make([]int, len(community))
+	for i, c := range community {
+		id, exists := ids[c]
+		if !exists {
+			id = len(ids)
+			ids[c] = id
+		}
+		out[i] = id
+	}
+	return out, len(ids)
+}
+
+// merge constructs the graph where every community is a single node.
+func merge(adj []map[int]float64, community []int, count int) []map[int]float64 {
+	merged := make([]map[int]float64, count)
+	for i := range merged {
+		merged[i] = make(map[int]float64)
+	}
+
+	for i := range adj {
+		for j, w := range adj[i] {
+			merged[community[i]][community[j]] += w
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"math"
+	"math/rand"
+)
+
+// PageRank returns the rank of every node. Rank flows from a follower to the
+// users it follows, so accounts followed by well followed accounts rank
+// highest. The ranks sum to 1. Iteration stops once the total change in
+// rank is below the tolerance or after the maximum number of iterations.
+func PageRank(g *Graph, damping float64, tolerance float64, iterations int) []float64 {
+	n := g.Len()
+	if n == 0 {
+		return nil
+	}
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+
+	next := make([]float64, n)
+	for iter := 0; iter < iterations; iter++ {
+
+		// Nodes without friends spread their rank evenly to every node.
+		var dangling float64
+		for i := range rank {
+			if len(g.out[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+			for _, j := range g.in[i] {
+				next[i] += damping * rank[j] / float64(len(g.out[j]))
+			}
+		}
+
+		var delta float64
+		for i := range rank {
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+
+		if delta < tolerance {
+			break
+		}
+	}
+
+	return rank
+}
+
+// Betweenness returns the betweenness centrality of every node, the number
+// of shortest paths between other nodes that pass through it. Computing it
+// exactly takes a breadth first search from every node, so for large graphs
+// only the specified number of randomly chosen sources are searched and the
+// result is scaled to estimate the exact value. If samples is 0 or at least
+// the number of nodes, the exact value is computed.
+func Betweenness(g *Graph, samples int, seed int64) []float64 {
+	n := g.Len()
+	scores := make([]float64, n)
+
+	sources := make([]int, n)
+	for i := range sources {
+		sources[i] = i
+	}
+
+	scale := 1.0
+	if samples > 0 && samples < n {
+		rnd := rand.New(rand.NewSource(seed))
+		rnd.Shuffle(n, func(i, j int) {
+			sources[i], sources[j] = sources[j], sources[i]
+		})
+		sources = sources[:samples]
+		scale = float64(n) / float64(samples)
+	}
+
+	// Brandes' algorithm, reusing the buffers across searches.
+	var (
+		stack = make([]int, 0, n)
+		queue = make([]int, 0, n)
+		preds = make([][]int, n)
+		sigma = make([]float64, n)
+		dist  = make([]int, n)
+		delta = make([]float64, n)
+	)
+
+	for _, s := range sources {
+		stack = stack[:0]
+		queue = queue[:0]
+		for i := 0; i < n; i++ {
+			preds[i] = preds[i][:0]
+			sigma[i] = 0
+			dist[i] = -1
+			delta[i] = 0
+		}
+
+		sigma[s] = 1
+		dist[s] = 0
+		queue = append(queue, s)
+
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+
+			for _, w := range g.out[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != s {
+				scores[w] += delta[w]
+			}
+		}
+	}
+
+	for i := range scores {
+		scores[i] *= scale
+	}
+
+	return scores
+}
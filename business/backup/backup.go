@@ -0,0 +1,322 @@
+// Package backup provides support for a logical backup of the users, friend
+// edges and follow history in the database as JSON Lines. Users are
+// identified by their source and source id so a backup can be restored into
+// any database.
+//
+// The first line is a header, followed by every user and then the follows,
+// friends and past friends of each user.
+//
+//	{"type":"header","version":2,"schema":"3f9a0c6e21b4","created":"2021-01-02T15:04:05Z"}
+//	{"type":"user","source":"twitter","source_id":"1","screen_name":"bill","name":"Bill"}
+//	{"type":"follow","source":"twitter","source_id":"1","friend_source":"twitter","friend_source_id":"2","since":"2020-03-01T00:00:00Z"}
+//	{"type":"friend","source":"twitter","source_id":"1","friend_source":"twitter","friend_source_id":"2"}
+//	{"type":"past_friend","source":"twitter","source_id":"1","friend_source":"twitter","friend_source_id":"3"}
+//
+// Version 1 backups hold no follow history or past friends and can still
+// be restored.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Version is the version of the backup format written by this package.
+const Version = 2
+
+// Set of record types found in a backup.
+const (
+	typeHeader     = "header"
+	typeUser       = "user"
+	typeFriend     = "friend"
+	typePastFriend = "past_friend"
+	typeFollow     = "follow"
+)
+
+// Header represents the first line of a backup.
+type Header struct {
+	Type    string    `json:"type"`
+	Version int       `json:"version"`
+	Schema  string    `json:"schema"`
+	Created time.Time `json:"created"`
+}
+
+// Stats represents what was written to or read from a backup.
+type Stats struct {
+	Schema      string
+	Users       int
+	Friends     int
+	PastFriends int
+	Follows     int
+}
+
+// Backup writes every user and friend edge in the database to w. Users are
+// read one page at a time so the database never has to fit in memory.
+func Backup(ctx context.Context, gql *graphql.GraphQL, w io.Writer, pageSize int) (Stats, error) {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+
+	enc := json.NewEncoder(w)
+
+	stats := Stats{Schema: schema.Version()}
+	h := Header{
+		Type:    typeHeader,
+		Version: Version,
+		Schema:  stats.Schema,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := enc.Encode(h); err != nil {
+		return stats, errors.Wrap(err, "writing header")
+	}
+
+	pages := func(list func(ctx context.Context, gql *graphql.GraphQL, offset int, limit int) ([]user.User, error), f func(u user.User) error) error {
+		for offset := 0; ; offset += pageSize {
+			users, err := list(ctx, gql, offset, pageSize)
+			if err != nil {
+				return errors.Wrapf(err, "listing users at offset %d", offset)
+			}
+
+			for _, u := range users {
+				if err := f(u); err != nil {
+					return err
+				}
+			}
+
+			if len(users) < pageSize {
+				return nil
+			}
+		}
+	}
+
+	// Every user is written before the first edge so a restore only has
+	// to look back for the users an edge references.
+	err := pages(user.List, func(u user.User) error {
+		stats.Users++
+		return enc.Encode(userRecord{
+			Type:         typeUser,
+			Source:       u.Source,
+			SourceID:     u.SourceID,
+			ScreenName:   u.ScreenName,
+			Name:         u.Name,
+			Location:     u.Location,
+			FriendsCount: u.FriendsCount,
+			LastSynced:   u.LastSynced,
+		})
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "writing users")
+	}
+
+	// The follows of a user are written before its friends so restoring
+	// a friend doesn't start a new follow.
+	err = pages(user.ListHistory, func(u user.User) error {
+		for _, f := range u.Follows {
+			stats.Follows++
+			rec := followRecord{
+				Type:           typeFollow,
+				Source:         u.Source,
+				SourceID:       u.SourceID,
+				FriendSource:   f.Friend.Source,
+				FriendSourceID: f.Friend.SourceID,
+				Since:          f.Since,
+			}
+			if !f.Until.IsZero() {
+				until := f.Until
+				rec.Until = &until
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range u.Friends {
+			stats.Friends++
+			if err := enc.Encode(newFriendRecord(typeFriend, u, f)); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range u.PastFriends {
+			stats.PastFriends++
+			if err := enc.Encode(newFriendRecord(typePastFriend, u, f)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return stats, errors.Wrap(err, "writing friends")
+	}
+
+	return stats, nil
+}
+
+// Restore reads a backup from r into the database. Users that already
+// exist are kept, so a restore that failed part way can be run again. The
+// follows are restored with the time they started and ended. Version 1
+// backups have no follow history, so their follows start at the time of
+// the restore.
+func Restore(ctx context.Context, gql *graphql.GraphQL, r io.Reader) (Stats, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return Stats{}, errors.Wrap(err, "reading header")
+		}
+		return Stats{}, errors.New("backup is empty")
+	}
+
+	var h Header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil || h.Type != typeHeader {
+		return Stats{}, errors.New("backup is missing its header")
+	}
+	if h.Version < 1 || h.Version > Version {
+		return Stats{}, errors.Errorf("backup version %d is not supported, expected up to %d", h.Version, Version)
+	}
+
+	stats := Stats{Schema: h.Schema}
+
+	// The map tracks the database id for each source identity restored.
+	ids := make(map[string]string)
+
+	// The time of the restore starts the follows of a backup without a
+	// follow history. Otherwise the follow records have started them.
+	restored := time.Now()
+
+	for line := 2; scanner.Scan(); line++ {
+		var rec followRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return stats, errors.Wrapf(err, "line %d", line)
+		}
+
+		var userID, friendID string
+		switch rec.Type {
+		case typeFollow, typeFriend, typePastFriend:
+			var exists bool
+			if userID, exists = ids[identity(rec.Source, rec.SourceID)]; !exists {
+				return stats, errors.Errorf("line %d: unknown user %s", line, identity(rec.Source, rec.SourceID))
+			}
+			if friendID, exists = ids[identity(rec.FriendSource, rec.FriendSourceID)]; !exists {
+				return stats, errors.Errorf("line %d: unknown friend %s", line, identity(rec.FriendSource, rec.FriendSourceID))
+			}
+		}
+
+		switch rec.Type {
+		case typeUser:
+			var ur userRecord
+			if err := json.Unmarshal(scanner.Bytes(), &ur); err != nil {
+				return stats, errors.Wrapf(err, "line %d", line)
+			}
+
+			nu := user.NewUser{
+				SourceID:     ur.SourceID,
+				Source:       ur.Source,
+				ScreenName:   ur.ScreenName,
+				Name:         ur.Name,
+				Location:     ur.Location,
+				FriendsCount: ur.FriendsCount,
+				LastSynced:   ur.LastSynced,
+			}
+			u, err := user.Add(ctx, gql, nu)
+			if err != nil && err != user.ErrExists {
+				return stats, errors.Wrapf(err, "line %d", line)
+			}
+			ids[identity(ur.Source, ur.SourceID)] = u.ID
+			stats.Users++
+
+		case typeFollow:
+			var until time.Time
+			if rec.Until != nil {
+				until = *rec.Until
+			}
+			if err := user.RestoreFollow(ctx, gql, userID, friendID, rec.Since, until); err != nil {
+				return stats, errors.Wrapf(err, "line %d", line)
+			}
+			stats.Follows++
+
+		case typeFriend:
+			nu := user.NewUser{SourceID: rec.FriendSourceID, Source: rec.FriendSource}
+			if _, err := user.AddFriend(ctx, gql, userID, nu, restored); err != nil {
+				return stats, errors.Wrapf(err, "line %d", line)
+			}
+			stats.Friends++
+
+		case typePastFriend:
+			if err := user.AddPastFriend(ctx, gql, userID, friendID); err != nil {
+				return stats, errors.Wrapf(err, "line %d", line)
+			}
+			stats.PastFriends++
+
+		default:
+			return stats, errors.Errorf("line %d: unknown record type %q", line, rec.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, errors.Wrap(err, "reading backup")
+	}
+
+	return stats, nil
+}
+
+// =============================================================================
+
+// userRecord represents a user in a backup.
+type userRecord struct {
+	Type         string    `json:"type"`
+	Source       string    `json:"source"`
+	SourceID     string    `json:"source_id"`
+	ScreenName   string    `json:"screen_name"`
+	Name         string    `json:"name"`
+	Location     string    `json:"location,omitempty"`
+	FriendsCount int       `json:"friends_count,omitempty"`
+	LastSynced   time.Time `json:"last_synced"`
+}
+
+// friendRecord represents a user following a friend in a backup.
+type friendRecord struct {
+	Type           string `json:"type"`
+	Source         string `json:"source"`
+	SourceID       string `json:"source_id"`
+	FriendSource   string `json:"friend_source"`
+	FriendSourceID string `json:"friend_source_id"`
+}
+
+// followRecord represents a period of time a user followed a friend in a
+// backup. A follow that hasn't ended has no until.
+type followRecord struct {
+	Type           string     `json:"type"`
+	Source         string     `json:"source"`
+	SourceID       string     `json:"source_id"`
+	FriendSource   string     `json:"friend_source"`
+	FriendSourceID string     `json:"friend_source_id"`
+	Since          time.Time  `json:"since"`
+	Until          *time.Time `json:"until,omitempty"`
+}
+
+// newFriendRecord returns the record of the type for the user and friend.
+func newFriendRecord(typ string, u user.User, friend user.User) friendRecord {
+	return friendRecord{
+		Type:           typ,
+		Source:         u.Source,
+		SourceID:       u.SourceID,
+		FriendSource:   friend.Source,
+		FriendSourceID: friend.SourceID,
+	}
+}
+
+// identity returns the key that identifies a user across databases.
+func identity(source string, sourceID string) string {
+	return fmt.Sprintf("%s/%s", source, sourceID)
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/graphql"
+)
+
+// ACLConfig represents the credentials for a cluster with access control
+// enabled. The client logs in with them and refreshes its access token
+// RefreshBefore it expires. Namespace is only used by multi-tenant clusters.
+type ACLConfig struct {
+	User          string
+	Password      string
+	Namespace     int
+	RefreshBefore time.Duration
+}
+
+// accessHeader is the header Dgraph expects the access token in.
+const accessHeader = "X-Dgraph-AccessToken"
+
+// session manages the access and refresh tokens for a cluster with access
+// control enabled.
+type session struct {
+	cfg   ACLConfig
+	admin *graphql.GraphQL
+
+	mu      sync.Mutex
+	access  string
+	refresh string
+	expires time.Time
+}
+
+// retrieve returns the current access token. The token is refreshed when it
+// is about to expire, and a new login is performed when there is no token or
+// it can't be refreshed.
+func (s *session) retrieve(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.access != "" && time.Until(s.expires) > s.cfg.RefreshBefore {
+		return s.access, nil
+	}
+
+	if s.refresh != "" {
+		if err := s.login(ctx, s.refresh); err == nil {
+			return s.access, nil
+		}
+	}
+
+	if err := s.login(ctx, ""); err != nil {
+		return "", err
+	}
+	return s.access, nil
+}
+
+// invalidate drops the tokens if the access token is still the specified
+// token. This keeps concurrent callers from throwing away a token that was
+// just obtained.
+func (s *session) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.access == token {
+		s.access = ""
+		s.refresh = ""
+	}
+}
+
+// login obtains new tokens using the refresh token, or the credentials when
+// no refresh token is provided. The lock must be held.
+func (s *session) login(ctx context.Context, refresh string) error {
+	query := `mutation login($userId: String, $password: String, $namespace: Int, $refreshToken: String) {
+		login(userId: $userId, password: $password, namespace: $namespace, refreshToken: $refreshToken) {
+			response {
+				accessJWT
+				refreshJWT
+			}
+		}
+	}`
+
+	vars := map[string]interface{}{
+		"refreshToken": refresh,
+	}
+	if refresh == "" {
+		vars = map[string]interface{}{
+			"userId":    s.cfg.User,
+			"password":  s.cfg.Password,
+			"namespace": s.cfg.Namespace,
+		}
+	}
+
+	var result struct {
+		Login struct {
+			Response struct {
+				AccessJWT  string `json:"accessJWT"`
+				RefreshJWT string `json:"refreshJWT"`
+			} `json:"response"`
+		} `json:"login"`
+	}
+	if err := s.admin.QueryWithVars(ctx, graphql.CmdAdmin, query, vars, &result); err != nil {
+		return err
+	}
+
+	resp := result.Login.Response
+	if resp.AccessJWT == "" {
+		return errors.New("login returned no access token")
+	}
+
+	s.access = resp.AccessJWT
+	s.refresh = resp.RefreshJWT
+	s.expires = expiry(resp.AccessJWT)
+
+	return nil
+}
+
+// expiry returns when the token expires. Dgraph signed the token, so its
+// claims are read without verifying it. A token that can't be read is
+// treated as already expired so it's refreshed before the next request.
+func expiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
+
+// =============================================================================
+
+// aclTransport adds the access token to every request. If the token is
+// rejected, the client logs in again and the request is tried one more time.
+type aclTransport struct {
+	next    http.RoundTripper
+	session *session
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (at aclTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	for relogged := false; ; relogged = true {
+		token, err := at.session.retrieve(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("acl login: %w", err)
+		}
+
+		r := req.Clone(req.Context())
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.Header.Set(accessHeader, token)
+
+		resp, err := at.next.RoundTrip(r)
+
+		var authErr *AuthError
+		rejected := errors.As(err, &authErr) || (err == nil && resp.StatusCode == http.StatusUnauthorized)
+		if !rejected || relogged {
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		at.session.invalidate(token)
+	}
+}
@@ -0,0 +1,226 @@
+package data_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// aclServer mimics a cluster with access control enabled. It hands out
+// tokens that expire after ttl and only accepts the latest access token.
+type aclServer struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	access   string
+	refresh  string
+	logins   int
+	refreshs int
+	issued   int
+}
+
+// token returns a token that expires after the ttl.
+func (as *aclServer) token() string {
+	as.issued++
+	enc := base64.RawURLEncoding
+	claims := fmt.Sprintf(`{"exp":%d,"n":%d}`, time.Now().Add(as.ttl).Unix(), as.issued)
+	return enc.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".sig"
+}
+
+// revoke forgets the tokens so the next request is rejected.
+func (as *aclServer) revoke() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.access = ""
+	as.refresh = ""
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (as *aclServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/admin") {
+		var req struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch {
+		case req.Variables["refreshToken"] != nil && req.Variables["refreshToken"] == as.refresh && as.refresh != "":
+			as.refreshs++
+		case req.Variables["userId"] == "groot" && req.Variables["password"] == "password":
+			as.logins++
+		default:
+			w.Write([]byte(`{"errors":[{"message":"invalid username or password"}]}`))
+			return
+		}
+
+		as.access, as.refresh = as.token(), as.token()
+		fmt.Fprintf(w, `{"data":{"login":{"response":{"accessJWT":%q,"refreshJWT":%q}}}}`, as.access, as.refresh)
+		return
+	}
+
+	if r.Header.Get("X-Dgraph-AccessToken") != as.access || as.access == "" {
+		w.Write([]byte(`{"errors":[{"message":"Token is expired","extensions":{"code":"ErrorUnauthorized"}}]}`))
+		return
+	}
+	w.Write([]byte(`{"data":{}}`))
+}
+
+// TestACL validates the client logs in, keeps its token fresh and logs in
+// again when the token is rejected.
+func TestACL(t *testing.T) {
+	t.Log("Given the need to talk to a cluster with access control enabled.")
+	{
+		as := aclServer{ttl: time.Hour}
+		srv := httptest.NewServer(&as)
+		defer srv.Close()
+
+		gqlConfig := data.GraphQLConfig{
+			URL:   srv.URL,
+			Retry: data.RetryConfig{Attempts: -1},
+			ACL:   data.ACLConfig{User: "groot", Password: "password"},
+		}
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the client is constructed.", testID)
+		{
+			gql, err := data.NewGraphQL(gqlConfig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to log in: %v", tests.Failed, testID, err)
+			}
+			if as.logins != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould log in on startup, got %d logins.", tests.Failed, testID, as.logins)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log in on startup.", tests.Success, testID)
+
+			if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query with the token: %v", tests.Failed, testID, err)
+			}
+			if as.logins != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould reuse the token, got %d logins.", tests.Failed, testID, as.logins)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reuse the token.", tests.Success, testID)
+
+			testID = 1
+			t.Logf("\tTest %d:\tWhen the token is rejected.", testID)
+			{
+				as.revoke()
+
+				if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to query after logging in again: %v", tests.Failed, testID, err)
+				}
+				if as.logins != 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould log in again, got %d logins.", tests.Failed, testID, as.logins)
+				}
+				t.Logf("\t%s\tTest %d:\tShould log in again.", tests.Success, testID)
+			}
+
+			testID = 2
+			t.Logf("\tTest %d:\tWhen many goroutines query after the token is rejected.", testID)
+			{
+				as.revoke()
+
+				var wg sync.WaitGroup
+				errs := make(chan error, 20)
+				for i := 0; i < 20; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						errs <- gql.Query(context.Background(), `query { queryUser { id } }`, nil)
+					}()
+				}
+				wg.Wait()
+				close(errs)
+
+				for err := range errs {
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to query concurrently: %v", tests.Failed, testID, err)
+					}
+				}
+				if as.logins != 3 {
+					t.Fatalf("\t%s\tTest %d:\tShould log in again only once, got %d logins.", tests.Failed, testID, as.logins)
+				}
+				t.Logf("\t%s\tTest %d:\tShould log in again only once.", tests.Success, testID)
+			}
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the token is about to expire.", testID)
+		{
+			as.ttl = time.Minute
+			var logs bytes.Buffer
+			cfg := gqlConfig
+			cfg.ACL.RefreshBefore = 2 * time.Minute
+			cfg.Instrument.Log = log.New(&logs, "", 0)
+
+			gql, err := data.NewGraphQL(cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to log in: %v", tests.Failed, testID, err)
+			}
+
+			if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query with the refreshed token: %v", tests.Failed, testID, err)
+			}
+			if as.refreshs != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould refresh the token before it expires, got %d refreshes.", tests.Failed, testID, as.refreshs)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refresh the token before it expires.", tests.Success, testID)
+
+			if strings.Contains(logs.String(), "login") || !strings.Contains(logs.String(), "query queryUser") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the query but not the logins: %s", tests.Failed, testID, logs.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the query but not the logins.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen the credentials are wrong.", testID)
+		{
+			cfg := gqlConfig
+			cfg.ACL.Password = "wrong"
+
+			if _, err := data.NewGraphQL(cfg); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail to log in on startup.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail to log in on startup.", tests.Success, testID)
+		}
+
+		testID = 5
+		t.Logf("\tTest %d:\tWhen the health of the cluster is checked.", testID)
+		{
+			logins := as.logins
+
+			client, err := data.NewHealthClient(gqlConfig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the health client: %v", tests.Failed, testID, err)
+			}
+			if as.logins != logins {
+				t.Fatalf("\t%s\tTest %d:\tShould not log in before the first request, got %d logins.", tests.Failed, testID, as.logins-logins)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not log in before the first request.", tests.Success, testID)
+
+			resp, err := client.Get(srv.URL + "/health")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check the health with the token: %v", tests.Failed, testID, err)
+			}
+			resp.Body.Close()
+			if as.logins != logins+1 {
+				t.Fatalf("\t%s\tTest %d:\tShould log in on the first request, got %d logins.", tests.Failed, testID, as.logins-logins)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log in on the first request.", tests.Success, testID)
+		}
+	}
+}
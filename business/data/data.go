@@ -2,41 +2,239 @@
 package data
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
 )
 
 // GraphQLConfig represents comfiguration needed to support managing, mutating,
-// and querying the database.
+// and querying the database. When a Signer is provided, every request carries
+// a token in the auth header minted with the claims from its context, or the
+// default Claims when the context has none. When ACL credentials are
+// provided, the client logs in and keeps its access token fresh. KeepAlive
+// is how long a subscription waits for a message, keep alives included,
+// before the connection is considered lost.
 type GraphQLConfig struct {
 	URL            string
 	AuthHeaderName string
 	AuthToken      string
+	Signer         *Signer
+	Claims         Claims
+	ACL            ACLConfig
+	Retry          RetryConfig
+	Instrument     InstrumentConfig
+	TLS            TLSConfig
+	KeepAlive      time.Duration
+}
+
+// TLSConfig represents the settings for connecting to a cluster over TLS.
+// CAFile is a bundle of PEM certificates used to verify the server in place
+// of the system roots. CertFile and KeyFile hold the client certificate for
+// clusters that require mutual TLS. InsecureSkipVerify disables verifying
+// the server and must only be used in development.
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
 }
 
 // NewGraphQL constructs a graphql value for use to access the databse.
-func NewGraphQL(gqlConfig GraphQLConfig) *graphql.GraphQL {
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+// Errors reported by the database are returned as an *Error so they can be
+// inspected with errors.As. Failed requests are retried according to the
+// retry policy in the configuration and every attempt can be logged and
+// traced.
+func NewGraphQL(gqlConfig GraphQLConfig) (*graphql.GraphQL, error) {
+	client, err := newClient(gqlConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	auth := graphql.WithAuth(gqlConfig.AuthHeaderName, gqlConfig.AuthToken)
-	graphql := graphql.New(gqlConfig.URL, &client, auth)
+	graphql := graphql.New(gqlConfig.URL, client, auth)
+
+	configs.Lock()
+	configs.m[graphql] = gqlConfig
+	configs.Unlock()
+
+	return graphql, nil
+}
+
+// configs holds the configuration of every graphql value constructed by
+// NewGraphQL, since the value itself doesn't expose it.
+var configs = struct {
+	sync.Mutex
+	m map[*graphql.GraphQL]GraphQLConfig
+}{m: make(map[*graphql.GraphQL]GraphQLConfig)}
+
+// configOf returns the configuration the graphql value was constructed with.
+func configOf(gql *graphql.GraphQL) (GraphQLConfig, bool) {
+	configs.Lock()
+	defer configs.Unlock()
+
+	gqlConfig, exists := configs.m[gql]
+	return gqlConfig, exists
+}
+
+// NewHealthClient constructs the http client for checking the health of the
+// cluster. It connects with the same TLS settings and access token as the
+// client of NewGraphQL, but it logs in on the first request so the health
+// can be checked while the cluster is starting. Requests are not retried,
+// logged or traced.
+func NewHealthClient(gqlConfig GraphQLConfig) (*http.Client, error) {
+	bare, err := newBareTransport(gqlConfig.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := bare
+	if gqlConfig.ACL.User != "" {
+		session := newIdleSession(gqlConfig.URL, gqlConfig.ACL, bare)
+		rt = aclTransport{next: bare, session: session}
+	}
+
+	return &http.Client{Transport: rt}, nil
+}
+
+// newClient constructs the http client every request to the database is
+// made with.
+func newClient(gqlConfig GraphQLConfig) (*http.Client, error) {
+	bare, err := newBareTransport(gqlConfig.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper = instrumentTransport{
+		next: bare,
+		cfg:  gqlConfig.Instrument,
+	}
+	if gqlConfig.Signer != nil {
+		rt = authTransport{
+			next:   rt,
+			signer: gqlConfig.Signer,
+			header: gqlConfig.AuthHeaderName,
+			claims: gqlConfig.Claims,
+		}
+	}
+
+	// Logging in sends the password and refresh token, so it bypasses the
+	// instrumentation and the credentials are never logged or traced.
+	if gqlConfig.ACL.User != "" {
+		session, err := newSession(gqlConfig.URL, gqlConfig.ACL, bare)
+		if err != nil {
+			return nil, err
+		}
+		rt = aclTransport{next: rt, session: session}
+	}
+
+	client := http.Client{
+		Transport: newRetryTransport(rt, gqlConfig.Retry),
+	}
+
+	return &client, nil
+}
+
+// newBareTransport constructs the transport that connects to the database
+// and turns the errors it reports into an *Error. Nothing sent through it is
+// logged, traced, signed or retried.
+func newBareTransport(cfg TLSConfig) (http.RoundTripper, error) {
+	tlsConfig, err := loadTLS(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading tls config")
+	}
+
+	transport := http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		TLSClientConfig:       tlsConfig,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return errorTransport{next: &transport}, nil
+}
+
+// newSession constructs a session for the credentials that logs in through
+// the transport, which must not log or trace the requests. It logs in right
+// away so bad credentials are reported on startup.
+func newSession(url string, cfg ACLConfig, rt http.RoundTripper) (*session, error) {
+	session := newIdleSession(url, cfg, rt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := session.retrieve(ctx); err != nil {
+		return nil, errors.Wrap(err, "acl login")
+	}
+
+	return session, nil
+}
+
+// newIdleSession constructs a session like newSession that doesn't log in
+// until the first request.
+func newIdleSession(url string, cfg ACLConfig, rt http.RoundTripper) *session {
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = 30 * time.Second
+	}
+
+	return &session{
+		cfg:   cfg,
+		admin: graphql.New(url, &http.Client{Transport: rt}),
+	}
+}
+
+// loadTLS constructs the tls configuration for the transport. If nothing is
+// configured, the transport defaults are used.
+func loadTLS(cfg TLSConfig) (*tls.Config, error) {
+	if cfg == (TLSConfig{}) {
+		return nil, nil
+	}
+
+	tlsConfig := tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading ca file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in ca file %q", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case cfg.CertFile != "" && cfg.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+
+	case cfg.CertFile != "" || cfg.KeyFile != "":
+		return nil, errors.New("client certificate and key must be provided together")
+	}
 
-	return graphql
+	return &tlsConfig, nil
 }
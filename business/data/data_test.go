@@ -1,13 +1,21 @@
 package data_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ardanlabs/dgraph/business/backup"
 	"github.com/ardanlabs/dgraph/business/data"
 	"github.com/ardanlabs/dgraph/business/data/ready"
 	"github.com/ardanlabs/dgraph/business/data/schema"
+	"github.com/ardanlabs/dgraph/business/data/stats"
 	"github.com/ardanlabs/dgraph/business/data/user"
 	"github.com/ardanlabs/dgraph/foundation/tests"
 	"github.com/ardanlabs/graphql"
@@ -25,22 +33,46 @@ func TestData(t *testing.T) {
 
 	t.Run("readiness", readiness(url))
 	t.Run("user", addUser(url))
+	t.Run("upsert", concurrentAdds(url))
+	t.Run("follows", follows(url))
+	t.Run("backup", backupRestore(url))
+	t.Run("stats", graphStats(url))
+	t.Run("auth", authRules(url))
+	t.Run("watch", watchUsers(url))
+}
+
+// testAuth tells the database how to verify the tokens signed in the tests.
+var testAuth = schema.Authorization{
+	Header:    "X-Test-Auth",
+	Namespace: data.DefaultNamespace,
+	Key:       "test-key",
+}
+
+// testConfig returns the configuration for a client that acts as an admin
+// unless its context carries other claims.
+func testConfig(url string) data.GraphQLConfig {
+	return data.GraphQLConfig{
+		URL:            url,
+		AuthHeaderName: testAuth.Header,
+		Signer:         data.NewSigner(testAuth.Key, testAuth.Namespace, time.Minute),
+		Claims:         data.Claims{Role: data.RoleAdmin},
+	}
 }
 
 // waitReady provides support for making sure the database is ready to be used.
 func waitReady(t *testing.T, ctx context.Context, testID int, url string) *graphql.GraphQL {
-	err := ready.Validate(ctx, url, time.Second)
+	err := ready.Validate(ctx, http.DefaultClient, url, time.Second)
 	if err != nil {
 		t.Fatalf("\t%s\tTest %d:\tShould be able to see Dgraph is ready: %v", tests.Failed, testID, err)
 	}
 	t.Logf("\t%s\tTest %d:\tShould be able to to see Dgraph is ready.", tests.Success, testID)
 
-	gqlConfig := data.GraphQLConfig{
-		URL: url,
+	gql, err := data.NewGraphQL(testConfig(url))
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
 	}
-	gql := data.NewGraphQL(gqlConfig)
 
-	schema := schema.New(gql)
+	schema := schema.New(gql, testAuth)
 	t.Logf("\t%s\tTest %d:\tShould be able to prepare the schema.", tests.Success, testID)
 
 	if err := schema.Create(ctx); err != nil {
@@ -80,7 +112,7 @@ func readiness(url string) func(t *testing.T) {
 						ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
 						defer cancel()
 
-						err := ready.Validate(ctx, url, test.retryDelay)
+						err := ready.Validate(ctx, http.DefaultClient, url, test.retryDelay)
 						switch test.success {
 						case true:
 							if err != nil {
@@ -157,3 +189,553 @@ func addUser(url string) func(t *testing.T) {
 	}
 	return tf
 }
+
+// concurrentAdds validates adding the same user from many goroutines at once
+// results in a single user.
+func concurrentAdds(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to add users from concurrent seeders.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen the same user is added in parallel.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				newUser := user.NewUser{
+					SourceID:   "123456",
+					Source:     "twitter",
+					ScreenName: "goinggodotnet",
+					Name:       "William Kennedy",
+				}
+
+				const adders = 10
+				users := make([]user.User, adders)
+				errs := make([]error, adders)
+
+				var wg sync.WaitGroup
+				for i := 0; i < adders; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						users[i], errs[i] = user.Add(ctx, gql, newUser)
+					}(i)
+				}
+				wg.Wait()
+
+				var added int
+				for i, err := range errs {
+					switch err {
+					case nil:
+						added++
+					case user.ErrExists:
+					default:
+						t.Fatalf("\t%s\tTest %d:\tShould be able to add the user: %v", tests.Failed, testID, err)
+					}
+					if users[i].ID != users[0].ID {
+						t.Fatalf("\t%s\tTest %d:\tShould get back the same user, got %s and %s.", tests.Failed, testID, users[0].ID, users[i].ID)
+					}
+				}
+				if added != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould add the user exactly once, got %d.", tests.Failed, testID, added)
+				}
+				t.Logf("\t%s\tTest %d:\tShould add the user exactly once.", tests.Success, testID)
+
+				count, _, err := user.Count(ctx, gql)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to count the users: %v", tests.Failed, testID, err)
+				}
+				if count != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould store a single user, got %d.", tests.Failed, testID, count)
+				}
+				t.Logf("\t%s\tTest %d:\tShould store a single user.", tests.Success, testID)
+			}
+
+			testID = 1
+			t.Logf("\tTest %d:\tWhen the same friend is added in parallel.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.OneBySourceID(ctx, gql, "twitter", "123456")
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to find the user: %v", tests.Failed, testID, err)
+				}
+
+				const adders = 10
+				errs := make([]error, adders)
+
+				var wg sync.WaitGroup
+				for i := 0; i < adders; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						_, errs[i] = user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "2", Source: "twitter", ScreenName: "jacksmith", Name: "Jack Smith"}, time.Now())
+					}(i)
+				}
+				wg.Wait()
+
+				for _, err := range errs {
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to add the friend: %v", tests.Failed, testID, err)
+					}
+				}
+
+				follows, err := user.Follows(ctx, gql, bill.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the follows: %v", tests.Failed, testID, err)
+				}
+				if len(follows) != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould start a single follow, got %d.", tests.Failed, testID, len(follows))
+				}
+				t.Logf("\t%s\tTest %d:\tShould start a single follow.", tests.Success, testID)
+
+				if _, err := user.AddFriend(ctx, gql, bill.ID+") { x as var(func: type(User)) }", user.NewUser{SourceID: "2", Source: "twitter"}, time.Now()); !errors.Is(err, user.ErrInvalidID) {
+					t.Fatalf("\t%s\tTest %d:\tShould reject a user id that isn't a uid: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould reject a user id that isn't a uid.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
+
+// follows validates the follow history of a user can be queried as of a
+// point in time.
+func follows(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to know who a user followed in the past.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen a user follows and unfollows friends over time.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.Add(ctx, gql, user.NewUser{SourceID: "1", Source: "twitter", ScreenName: "goinggodotnet", Name: "William Kennedy"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to add a user.", tests.Success, testID)
+
+				march := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+				april := march.AddDate(0, 1, 0)
+				may := april.AddDate(0, 1, 0)
+
+				jack, err := user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "2", Source: "twitter", ScreenName: "jacksmith", Name: "Jack Smith"}, march)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend: %v", tests.Failed, testID, err)
+				}
+				jane, err := user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "3", Source: "twitter", ScreenName: "janedoe", Name: "Jane Doe"}, april)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend: %v", tests.Failed, testID, err)
+				}
+				if err := user.RemoveFriend(ctx, gql, bill.ID, jack.ID, may); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to remove a friend: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to change friends over time.", tests.Success, testID)
+
+				ids := func(users []user.User) []string {
+					var list []string
+					for _, u := range users {
+						list = append(list, u.ID)
+					}
+					sort.Strings(list)
+					return list
+				}
+
+				type tableTest struct {
+					at  time.Time
+					exp []user.User
+				}
+
+				tt := []tableTest{
+					{march.AddDate(0, 0, -1), nil},
+					{march.AddDate(0, 0, 15), []user.User{jack}},
+					{april.AddDate(0, 0, 15), []user.User{jack, jane}},
+					{may.AddDate(0, 0, 15), []user.User{jane}},
+				}
+
+				for _, test := range tt {
+					friends, err := user.FriendsAsOf(ctx, gql, bill.ID, test.at)
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to query friends as of %s: %v", tests.Failed, testID, test.at.Format("2006-01-02"), err)
+					}
+					if diff := cmp.Diff(ids(test.exp), ids(friends)); diff != "" {
+						t.Fatalf("\t%s\tTest %d:\tShould get back the friends as of %s. Diff:\n%s", tests.Failed, testID, test.at.Format("2006-01-02"), diff)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get back the friends as of %s.", tests.Success, testID, test.at.Format("2006-01-02"))
+				}
+
+				added, removed, err := user.FriendsDiff(ctx, gql, bill.ID, march.AddDate(0, 0, 15), may.AddDate(0, 0, 15))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to diff friends: %v", tests.Failed, testID, err)
+				}
+				if diff := cmp.Diff([]string{jane.ID}, ids(added)); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the friends added. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				if diff := cmp.Diff([]string{jack.ID}, ids(removed)); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the friends removed. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the friends added and removed.", tests.Success, testID)
+
+				if _, err := user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "2", Source: "twitter"}, may.AddDate(0, 1, 0)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to follow a past friend again: %v", tests.Failed, testID, err)
+				}
+
+				var result struct {
+					GetUser user.User `json:"getUser"`
+				}
+				query := fmt.Sprintf(`query { getUser(id: %q) { friends { id } past_friends { id } } }`, bill.ID)
+				if err := gql.Query(ctx, query, &result); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to query the friends: %v", tests.Failed, testID, err)
+				}
+				if diff := cmp.Diff(ids([]user.User{jack, jane}), ids(result.GetUser.Friends)); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould follow the past friend again. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				if len(result.GetUser.PastFriends) != 0 {
+					t.Fatalf("\t%s\tTest %d:\tShould not keep a followed friend in the past friends: %v", tests.Failed, testID, result.GetUser.PastFriends)
+				}
+				t.Logf("\t%s\tTest %d:\tShould move a past friend that is followed again back to the friends.", tests.Success, testID)
+
+				// Friends stored before follows were recorded have no history.
+				joe, err := user.Add(ctx, gql, user.NewUser{SourceID: "4", Source: "twitter", ScreenName: "joe", Name: "Joe", LastSynced: march})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				mutation := fmt.Sprintf(`mutation { updateUser(input: { filter: { id: [%q] }, set: { friends: [{ id: %q }] } }) { numUids } }`, joe.ID, jane.ID)
+				if err := gql.Query(ctx, mutation, nil); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend without a follow: %v", tests.Failed, testID, err)
+				}
+
+				backfilled, err := user.BackfillFollows(ctx, gql, time.Now())
+				if err != nil || backfilled != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould backfill the follow, got %d: %v", tests.Failed, testID, backfilled, err)
+				}
+				friends, err := user.FriendsAsOf(ctx, gql, joe.ID, march.AddDate(0, 0, 1))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to query friends: %v", tests.Failed, testID, err)
+				}
+				if diff := cmp.Diff([]string{jane.ID}, ids(friends)); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould follow since the user was last synced. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				if backfilled, err := user.BackfillFollows(ctx, gql, time.Now()); err != nil || backfilled != 0 {
+					t.Fatalf("\t%s\tTest %d:\tShould not backfill twice, got %d: %v", tests.Failed, testID, backfilled, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould backfill the follows of friends stored without one.", tests.Success, testID)
+
+				// Users stored before users had a key, one a duplicate of joe.
+				for _, nu := range []user.NewUser{{SourceID: "5", Source: "twitter", ScreenName: "ann", Name: "Ann"}, {SourceID: "4", Source: "twitter", ScreenName: "joe", Name: "Joe"}} {
+					set := map[string]interface{}{"uid": "_:user", "dgraph.type": "User", "User.source": nu.Source, "User.source_id": nu.SourceID, "User.screen_name": nu.ScreenName, "User.name": nu.Name}
+					if _, err := data.NewUpsert().Mutate("", data.Mutation{Set: set}).Exec(ctx, gql); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to add a user without a key: %v", tests.Failed, testID, err)
+					}
+				}
+
+				keys, duplicates, err := user.BackfillKeys(ctx, gql)
+				if err != nil || keys != 1 || duplicates != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould set 1 key and skip 1 duplicate, got %d and %d: %v", tests.Failed, testID, keys, duplicates, err)
+				}
+				var byKey struct {
+					GetUser *user.User `json:"getUser"`
+				}
+				if err := gql.Query(ctx, `query { getUser(key: "twitter:5") { id } }`, &byKey); err != nil || byKey.GetUser == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould find the user by key: %v", tests.Failed, testID, err)
+				}
+				if keys, duplicates, err := user.BackfillKeys(ctx, gql); err != nil || keys != 0 || duplicates != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould not set a key twice, got %d and %d: %v", tests.Failed, testID, keys, duplicates, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould backfill the keys of users stored without one.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
+
+// backupRestore validates the users, friend edges and follow history
+// survive dropping the data when a backup is restored.
+func backupRestore(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to recover the database from a backup.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen a backup is restored after the data is dropped.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.Add(ctx, gql, user.NewUser{SourceID: "1", Source: "twitter", ScreenName: "goinggodotnet", Name: "William Kennedy", Location: "Miami", FriendsCount: 1})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				since := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+				until := since.AddDate(0, 6, 0)
+				if _, err := user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "2", Source: "twitter", ScreenName: "jacksmith", Name: "Jack Smith"}, since); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend: %v", tests.Failed, testID, err)
+				}
+				jane, err := user.AddFriend(ctx, gql, bill.ID, user.NewUser{SourceID: "3", Source: "twitter", ScreenName: "janedoe", Name: "Jane Doe"}, since)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend: %v", tests.Failed, testID, err)
+				}
+				if err := user.RemoveFriend(ctx, gql, bill.ID, jane.ID, until); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to remove a friend: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to add a user, a friend and a past friend.", tests.Success, testID)
+
+				var buf bytes.Buffer
+				stats, err := backup.Backup(ctx, gql, &buf, 1)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to backup the data: %v", tests.Failed, testID, err)
+				}
+				if stats.Users != 3 || stats.Friends != 1 || stats.PastFriends != 1 || stats.Follows != 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould backup 3 users, 1 friend, 1 past friend and 2 follows, got %+v.", tests.Failed, testID, stats)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to backup the data.", tests.Success, testID)
+
+				if err := schema.New(gql, testAuth).DropData(ctx); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to drop the data: %v", tests.Failed, testID, err)
+				}
+
+				if _, err := backup.Restore(ctx, gql, &buf); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to restore the data: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to restore the data.", tests.Success, testID)
+
+				restored, err := user.OneBySourceID(ctx, gql, "twitter", "1")
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to find the restored user: %v", tests.Failed, testID, err)
+				}
+				bill.ID = restored.ID
+				if diff := cmp.Diff(bill, restored); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the same user. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the same user.", tests.Success, testID)
+
+				friends, err := user.Friends(ctx, gql, restored.ID)
+				if err != nil || len(friends) != 1 || friends[0].SourceID != "2" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the same friends: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the same friends.", tests.Success, testID)
+
+				follows, err := user.Follows(ctx, gql, restored.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the follows: %v", tests.Failed, testID, err)
+				}
+				if len(follows) != 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould get back 2 follows, got %d.", tests.Failed, testID, len(follows))
+				}
+				for _, f := range follows {
+					if !f.Since.Equal(since) {
+						t.Fatalf("\t%s\tTest %d:\tShould keep when %s was followed, got %v.", tests.Failed, testID, f.Friend.ScreenName, f.Since)
+					}
+					switch f.Friend.SourceID {
+					case "2":
+						if !f.Until.IsZero() {
+							t.Fatalf("\t%s\tTest %d:\tShould still follow %s, got until %v.", tests.Failed, testID, f.Friend.ScreenName, f.Until)
+						}
+					case "3":
+						if !f.Until.Equal(until) {
+							t.Fatalf("\t%s\tTest %d:\tShould keep when %s was unfollowed, got %v.", tests.Failed, testID, f.Friend.ScreenName, f.Until)
+						}
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the same follow history.", tests.Success, testID)
+
+				history, err := user.ListHistory(ctx, gql, 0, 10)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to list the history: %v", tests.Failed, testID, err)
+				}
+				var past []string
+				for _, u := range history {
+					if u.ID == restored.ID {
+						for _, f := range u.PastFriends {
+							past = append(past, f.SourceID)
+						}
+					}
+				}
+				if diff := cmp.Diff([]string{"3"}, past); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the same past friends. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the same past friends.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
+
+// graphStats validates the stats are computed from what is stored.
+func graphStats(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to summarize what is stored.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen a user follows two friends and one user is isolated.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.Add(ctx, gql, user.NewUser{SourceID: "1", Source: "twitter", ScreenName: "goinggodotnet", Name: "William Kennedy", FriendsCount: 20, LastSynced: time.Now()})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				for _, nu := range []user.NewUser{
+					{SourceID: "2", Source: "twitter", ScreenName: "jacksmith", Name: "Jack Smith"},
+					{SourceID: "3", Source: "twitter", ScreenName: "janedoe", Name: "Jane Doe"},
+				} {
+					if _, err := user.AddFriend(ctx, gql, bill.ID, nu, time.Now()); err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to add a friend: %v", tests.Failed, testID, err)
+					}
+				}
+				loner, err := user.Add(ctx, gql, user.NewUser{SourceID: "4", Source: "github", ScreenName: "loner", Name: "Lone User"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to add the users.", tests.Success, testID)
+
+				s, err := stats.Retrieve(ctx, gql, stats.Config{Top: 5, MinMissing: 10})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the stats: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to retrieve the stats.", tests.Success, testID)
+
+				bySource := map[string]int{"twitter": 3, "github": 1}
+				if s.Users != 4 || s.Edges != 2 || s.Isolated != 1 || !cmp.Equal(bySource, s.BySource) {
+					t.Fatalf("\t%s\tTest %d:\tShould count the users and edges: %+v", tests.Failed, testID, s)
+				}
+				t.Logf("\t%s\tTest %d:\tShould count the users and edges.", tests.Success, testID)
+
+				if len(s.TopOut) != 1 || s.TopOut[0].ScreenName != "goinggodotnet" || s.TopOut[0].Degree != 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould rank the user with the most friends: %+v", tests.Failed, testID, s.TopOut)
+				}
+				t.Logf("\t%s\tTest %d:\tShould rank the user with the most friends.", tests.Success, testID)
+
+				if len(s.Partial) != 1 || s.Partial[0].Missing != 18 {
+					t.Fatalf("\t%s\tTest %d:\tShould find the partially crawled user: %+v", tests.Failed, testID, s.Partial)
+				}
+				t.Logf("\t%s\tTest %d:\tShould find the partially crawled user.", tests.Success, testID)
+
+				high, low := 0.9, 0.1
+				updates := map[string]user.UpdateUser{
+					bill.ID:  {PageRank: &low},
+					loner.ID: {PageRank: &high},
+				}
+				if err := user.UpdateMany(ctx, gql, updates); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to update the users in one request: %v", tests.Failed, testID, err)
+				}
+				top, err := user.TopByPageRank(ctx, gql, 2)
+				if err != nil || len(top) != 2 || top[0].ID != loner.ID || top[1].ID != bill.ID {
+					t.Fatalf("\t%s\tTest %d:\tShould rank the users by the updated pagerank: %+v, %v", tests.Failed, testID, top, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould rank the users by the updated pagerank.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
+
+// authRules validates users can only update their own profile.
+func authRules(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to protect a user's profile.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen a user updates profiles.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.Add(ctx, gql, user.NewUser{SourceID: "1", Source: "twitter", ScreenName: "goinggodotnet", Name: "William Kennedy"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				jack, err := user.Add(ctx, gql, user.NewUser{SourceID: "2", Source: "twitter", ScreenName: "jacksmith", Name: "Jack Smith"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to add the users as an admin.", tests.Success, testID)
+
+				billCtx := data.WithClaims(ctx, data.Claims{UserID: bill.ID, Role: data.RoleUser})
+
+				name := "Bill Kennedy"
+				if err := user.Update(billCtx, gql, bill.ID, user.UpdateUser{Name: &name}); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to update their own profile: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to update their own profile.", tests.Success, testID)
+
+				if err := user.Update(billCtx, gql, jack.ID, user.UpdateUser{Name: &name}); !errors.Is(err, user.ErrNotExists) {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to update another profile: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not be able to update another profile.", tests.Success, testID)
+
+				got, err := user.One(ctx, gql, jack.ID)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to query the user: %v", tests.Failed, testID, err)
+				}
+				if got.Name != "Jack Smith" {
+					t.Fatalf("\t%s\tTest %d:\tShould leave the other profile unchanged, got %q.", tests.Failed, testID, got.Name)
+				}
+				t.Logf("\t%s\tTest %d:\tShould leave the other profile unchanged.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
+
+// watchUsers validates changes to a user are pushed to its watchers.
+func watchUsers(url string) func(t *testing.T) {
+	tf := func(t *testing.T) {
+		t.Log("Given the need to be told about changes to a user.")
+		{
+			testID := 0
+			t.Logf("\tTest %d:\tWhen a watched user is updated.", testID)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 25*time.Second)
+				defer cancel()
+
+				gql := waitReady(t, ctx, testID, url)
+
+				bill, err := user.Add(ctx, gql, user.NewUser{SourceID: "1", Source: "twitter", ScreenName: "goinggodotnet", Name: "William Kennedy"})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to add a user: %v", tests.Failed, testID, err)
+				}
+
+				ch, err := user.Watch(ctx, gql, user.Filter{IDs: []string{bill.ID}})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to watch the user: %v", tests.Failed, testID, err)
+				}
+				if u := <-ch; u.Name != "William Kennedy" {
+					t.Fatalf("\t%s\tTest %d:\tShould receive the current profile, got %q.", tests.Failed, testID, u.Name)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive the current profile.", tests.Success, testID)
+
+				name := "Bill Kennedy"
+				if err := user.Update(ctx, gql, bill.ID, user.UpdateUser{Name: &name}); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to update the user: %v", tests.Failed, testID, err)
+				}
+
+				select {
+				case u := <-ch:
+					if u.Name != name {
+						t.Fatalf("\t%s\tTest %d:\tShould receive the change, got %q.", tests.Failed, testID, u.Name)
+					}
+				case <-ctx.Done():
+					t.Fatalf("\t%s\tTest %d:\tShould receive the change before timing out.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive the change.", tests.Success, testID)
+			}
+		}
+	}
+	return tf
+}
@@ -0,0 +1,253 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Location represents the position in the query an error refers to.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GQLError represents a single error reported by the database.
+type GQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Code returns the code the database reported in the extensions, if any.
+func (ge GQLError) Code() string {
+	code, _ := ge.Extensions["code"].(string)
+	return code
+}
+
+// Error represents every error the database reported for a single request.
+// It can be matched with errors.As against the specific error types below
+// to branch on what kind of failure occurred.
+type Error struct {
+	Command string
+	Status  int
+	Errors  []GQLError
+}
+
+// Error implements the error interface. Every message is reported.
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, ge := range e.Errors {
+		msg := ge.Message
+		if len(ge.Path) > 0 {
+			msg = fmt.Sprintf("%s: %s", pathString(ge.Path), msg)
+		}
+		msgs[i] = msg
+	}
+	return fmt.Sprintf("dgraph %s error: %s", e.Command, strings.Join(msgs, "; "))
+}
+
+// As allows errors.As to match the error against the specific error types.
+// An error can match more than one type when the database reported several
+// failures.
+func (e *Error) As(target interface{}) bool {
+	switch t := target.(type) {
+	case **NotReadyError:
+		if e.is(notReady) {
+			*t = &NotReadyError{Err: e}
+			return true
+		}
+	case **AuthError:
+		if e.is(unauthorized) {
+			*t = &AuthError{Err: e}
+			return true
+		}
+	case **ConflictError:
+		if e.is(conflict) {
+			*t = &ConflictError{Err: e}
+			return true
+		}
+	case **ValidationError:
+		if e.is(invalid) {
+			*t = &ValidationError{Err: e}
+			return true
+		}
+	}
+	return false
+}
+
+// is reports if any of the errors matches the specified check.
+func (e *Error) is(check func(status int, ge GQLError) bool) bool {
+	for _, ge := range e.Errors {
+		if check(e.Status, ge) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotReadyError is matched when the database isn't ready to serve the
+// request yet. The request can be retried later.
+type NotReadyError struct {
+	Err *Error
+}
+
+// Error implements the error interface.
+func (e *NotReadyError) Error() string { return e.Err.Error() }
+
+// AuthError is matched when the request was rejected because of missing,
+// invalid or expired credentials or a lack of permissions.
+type AuthError struct {
+	Err *Error
+}
+
+// Error implements the error interface.
+func (e *AuthError) Error() string { return e.Err.Error() }
+
+// ConflictError is matched when a transaction was aborted because it
+// conflicted with another one. The request can be retried.
+type ConflictError struct {
+	Err *Error
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string { return e.Err.Error() }
+
+// ValidationError is matched when the request itself is invalid, such as a
+// syntax error, an unknown field or a bad variable.
+type ValidationError struct {
+	Err *Error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+// =============================================================================
+
+// notReady reports if the error means the database isn't ready.
+func notReady(status int, ge GQLError) bool {
+	if status == http.StatusServiceUnavailable {
+		return true
+	}
+	msg := strings.ToLower(ge.Message)
+	return strings.Contains(msg, "server not ready") ||
+		strings.Contains(msg, "server is not ready") ||
+		strings.Contains(msg, "not ready to accept requests")
+}
+
+// unauthorizedMessages are the messages the database reports when the
+// credentials are rejected but no status or code says so. Some are followed
+// by details, so a message only has to start with one of them.
+var unauthorizedMessages = []string{
+	"Token is expired",
+	"no accessJwt available",
+	"unable to parse jwt token",
+	"rpc error: code = Unauthenticated",
+	"rpc error: code = PermissionDenied",
+}
+
+// unauthorized reports if the error means the credentials were rejected.
+func unauthorized(status int, ge GQLError) bool {
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return true
+	}
+	switch ge.Code() {
+	case "ErrorUnauthorized", "ErrorForbidden", "Unauthenticated", "PermissionDenied":
+		return true
+	}
+	for _, s := range unauthorizedMessages {
+		if strings.HasPrefix(ge.Message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflict reports if the error means the transaction was aborted.
+func conflict(status int, ge GQLError) bool {
+	if status == http.StatusConflict || ge.Code() == "ErrorAborted" {
+		return true
+	}
+	msg := strings.ToLower(ge.Message)
+	return strings.Contains(msg, "transaction has been aborted") ||
+		strings.Contains(msg, "transaction aborted")
+}
+
+// invalid reports if the error means the request itself was rejected.
+// Errors with a location but no path are reported while the request is
+// parsed and validated, before anything is resolved.
+func invalid(status int, ge GQLError) bool {
+	if status == http.StatusBadRequest || ge.Code() == "ErrorInvalidRequest" {
+		return true
+	}
+	if len(ge.Locations) > 0 && len(ge.Path) == 0 {
+		return true
+	}
+	msg := strings.ToLower(ge.Message)
+	for _, s := range []string{"syntax error", "cannot query field", "unknown argument", "unknown type", "is not defined", "expected type", "while lexing"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathString formats the path of an error the way it appears in a query.
+func pathString(p []interface{}) string {
+	var b strings.Builder
+	for i, v := range p {
+		switch v := v.(type) {
+		case float64:
+			fmt.Fprintf(&b, "[%d]", int(v))
+		default:
+			if i > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// =============================================================================
+
+// errorTransport inspects every response from the database and turns the
+// errors it reports into an *Error. The graphql client only reports the
+// first message as a string, so the response is checked before the client
+// gets to see it.
+type errorTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (et errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := et.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Errors []GQLError `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &result); err == nil && len(result.Errors) > 0 {
+		return nil, &Error{
+			Command: path.Base(req.URL.Path),
+			Status:  resp.StatusCode,
+			Errors:  result.Errors,
+		}
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
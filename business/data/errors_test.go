@@ -0,0 +1,82 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestErrors validates the errors reported by the database can be inspected.
+func TestErrors(t *testing.T) {
+	t.Log("Given the need to branch on the errors the database reports.")
+	{
+		table := []struct {
+			name     string
+			status   int
+			body     string
+			notReady bool
+			auth     bool
+			conflict bool
+			invalid  bool
+			messages int
+		}{
+			{"notready", http.StatusOK, `{"errors":[{"message":"Server not ready"}]}`, true, false, false, false, 1},
+			{"auth", http.StatusOK, `{"errors":[{"message":"Token is expired","extensions":{"code":"ErrorUnauthorized"}}]}`, false, true, false, false, 1},
+			{"authstatus", http.StatusForbidden, `{"errors":[{"message":"access denied"}]}`, false, true, false, false, 1},
+			{"authmessage", http.StatusOK, `{"errors":[{"message":"unable to parse jwt token: token contains an invalid number of segments"}]}`, false, true, false, false, 1},
+			{"notauth", http.StatusOK, `{"errors":[{"message":"value for jwt_claims has permission denied characters","path":["queryUser",0,"name"]}]}`, false, false, false, false, 1},
+			{"conflict", http.StatusOK, `{"errors":[{"message":"Transaction has been aborted. Please retry","extensions":{"code":"ErrorAborted"}}]}`, false, false, true, false, 1},
+			{"validation", http.StatusOK, `{"errors":[{"message":"Cannot query field \"nope\" on type \"User\".","locations":[{"line":1,"column":9}]},{"message":"second failure","path":["queryUser",0,"name"]}]}`, false, false, false, true, 2},
+		}
+
+		for testID, tt := range table {
+			tf := func(t *testing.T) {
+				t.Logf("\tTest %d:\tWhen the database reports a %s error.", testID, tt.name)
+				{
+					srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						w.WriteHeader(tt.status)
+						w.Write([]byte(tt.body))
+					}))
+					defer srv.Close()
+
+					gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: data.RetryConfig{Attempts: -1}})
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+					}
+
+					err = gql.Query(context.Background(), `query { queryUser { nope } }`, nil)
+
+					var dErr *data.Error
+					if !errors.As(err, &dErr) {
+						t.Fatalf("\t%s\tTest %d:\tShould get back a data error: %v", tests.Failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get back a data error.", tests.Success, testID)
+
+					if len(dErr.Errors) != tt.messages {
+						t.Fatalf("\t%s\tTest %d:\tShould get back every message, exp %d got %d.", tests.Failed, testID, tt.messages, len(dErr.Errors))
+					}
+					t.Logf("\t%s\tTest %d:\tShould get back every message.", tests.Success, testID)
+
+					var notReady *data.NotReadyError
+					var auth *data.AuthError
+					var conflict *data.ConflictError
+					var invalid *data.ValidationError
+					got := []bool{errors.As(err, &notReady), errors.As(err, &auth), errors.As(err, &conflict), errors.As(err, &invalid)}
+					exp := []bool{tt.notReady, tt.auth, tt.conflict, tt.invalid}
+					for i := range exp {
+						if got[i] != exp[i] {
+							t.Fatalf("\t%s\tTest %d:\tShould match the expected error types, exp %v got %v.", tests.Failed, testID, exp, got)
+						}
+					}
+					t.Logf("\t%s\tTest %d:\tShould match the expected error types.", tests.Success, testID)
+				}
+			}
+			t.Run(tt.name, tf)
+		}
+	}
+}
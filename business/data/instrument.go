@@ -0,0 +1,183 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/dgraph/foundation/trace"
+)
+
+// InstrumentConfig represents the settings for instrumenting every request
+// made to the database. When Log is set, every request is logged with its
+// operation, duration, response size and error. When Tracer is set, a span
+// is recorded for every request and sent to the database as a traceparent
+// header. The values of the variables named in Redact are never logged or
+// traced, and a "*" redacts every variable. The statement recorded on a span
+// always has its literal values replaced, since they can't be told apart.
+type InstrumentConfig struct {
+	Log    *log.Logger
+	Tracer *trace.Tracer
+	Redact []string
+}
+
+// =============================================================================
+
+// instrumentTransport logs and traces every request made to the database.
+type instrumentTransport struct {
+	next http.RoundTripper
+	cfg  InstrumentConfig
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (it instrumentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if it.cfg.Log == nil && it.cfg.Tracer == nil {
+		return it.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	json.Unmarshal(body, &request)
+
+	command := path.Base(req.URL.Path)
+	op := operation(command, request.Query)
+	vars := redact(request.Variables, it.cfg.Redact)
+
+	ctx, span := it.cfg.Tracer.Start(req.Context(), "dgraph "+op)
+	span.SetAttribute("db.system", "dgraph")
+	span.SetAttribute("db.operation", op)
+	span.SetAttribute("db.statement", statement(request.Query))
+	span.SetAttribute("dgraph.command", command)
+	if len(vars) > 0 {
+		span.SetAttribute("dgraph.variables", vars)
+	}
+
+	r := req.WithContext(ctx)
+	if tp := span.TraceParent(); tp != "" {
+		r.Header = req.Header.Clone()
+		r.Header.Set("traceparent", tp)
+	}
+
+	start := time.Now()
+	resp, err := it.next.RoundTrip(r)
+	duration := time.Since(start)
+
+	var size int
+	if err == nil {
+		var data []byte
+		data, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		size = len(data)
+
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		span.SetAttribute("dgraph.response_size", size)
+	}
+
+	if spanErr := span.End(err); spanErr != nil && it.cfg.Log != nil {
+		it.cfg.Log.Printf("dgraph: %s: %v", op, spanErr)
+	}
+
+	if it.cfg.Log != nil {
+		msg := fmt.Sprintf("dgraph: %s: %v: %d bytes", op, duration, size)
+		if len(vars) > 0 {
+			v, _ := json.Marshal(vars)
+			msg += fmt.Sprintf(": vars %s", v)
+		}
+		if err != nil {
+			msg += fmt.Sprintf(": ERROR: %v", err)
+		}
+		it.cfg.Log.Print(msg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// opName matches the type and name of an operation in a query.
+var opName = regexp.MustCompile(`^\s*(query|mutation|subscription)\b\s*(\w*)`)
+
+// opField matches the first field selected by a query.
+var opField = regexp.MustCompile(`^[^{]*\{\s*(\w+)`)
+
+// operation returns a name for the request that can be used to find it in
+// the logs. Named operations are reported by name, anonymous ones by the
+// first field they select.
+func operation(command string, query string) string {
+	if command == "alter" {
+		return command
+	}
+
+	kind := "query"
+	if m := opName.FindStringSubmatch(query); m != nil {
+		kind = m[1]
+		if m[2] != "" {
+			return kind + " " + m[2]
+		}
+	}
+	if m := opField.FindStringSubmatch(query); m != nil {
+		return kind + " " + m[1]
+	}
+	return kind
+}
+
+// literals matches the string and number values written into a query.
+// Numbers are only matched when they don't end an identifier.
+var literals = regexp.MustCompile(`"""(?s:.*?)"""|"(?:\\.|[^"\\])*"|(^|[^\w$.])-?\d+(?:\.\d+)?(?:[eE][+-]?\d+)?\b`)
+
+// statement returns the query with every literal value replaced by a
+// placeholder, so values formatted into the query aren't traced.
+func statement(query string) string {
+	return literals.ReplaceAllStringFunc(query, func(lit string) string {
+		if strings.HasSuffix(lit, `"`) {
+			return `"?"`
+		}
+		if c := lit[0]; c != '-' && (c < '0' || c > '9') {
+			return lit[:1] + "?"
+		}
+		return "?"
+	})
+}
+
+// redact returns a copy of the variables with the values of the named ones
+// replaced.
+func redact(vars map[string]interface{}, names []string) map[string]interface{} {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	hide := make(map[string]bool)
+	for _, name := range names {
+		hide[strings.TrimPrefix(name, "$")] = true
+	}
+
+	out := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		if hide["*"] || hide[k] {
+			v = "REDACTED"
+		}
+		out[k] = v
+	}
+	return out
+}
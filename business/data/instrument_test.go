@@ -0,0 +1,117 @@
+package data_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/ardanlabs/dgraph/foundation/trace"
+)
+
+// TestInstrument validates every request is logged and traced.
+func TestInstrument(t *testing.T) {
+	t.Log("Given the need to find slow queries.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a query with variables is made.", testID)
+		{
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"data":{"queryUser":[]}}`))
+			}))
+			defer srv.Close()
+
+			var logs, spans bytes.Buffer
+			gqlConfig := data.GraphQLConfig{
+				URL: srv.URL,
+				Instrument: data.InstrumentConfig{
+					Log:    log.New(&logs, "", 0),
+					Tracer: trace.New(trace.NewJSONExporter(&spans)),
+					Redact: []string{"token"},
+				},
+			}
+			gql, err := data.NewGraphQL(gqlConfig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+
+			query := `query findUser($name: String!, $token: String!) { queryUser(filter: {screen_name: {eq: $name}}) { id } }`
+			vars := map[string]interface{}{"name": "goinggodotnet", "token": "secret"}
+			if err := gql.QueryWithVars(context.Background(), "graphql", query, vars, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the query: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to make the query.", tests.Success, testID)
+
+			line := logs.String()
+			if !strings.Contains(line, "query findUser") || !strings.Contains(line, "25 bytes") || !strings.Contains(line, "goinggodotnet") {
+				t.Fatalf("\t%s\tTest %d:\tShould log the operation, size and variables: %s", tests.Failed, testID, line)
+			}
+			t.Logf("\t%s\tTest %d:\tShould log the operation, size and variables.", tests.Success, testID)
+
+			if strings.Contains(logs.String()+spans.String(), "secret") {
+				t.Fatalf("\t%s\tTest %d:\tShould redact the token: %s %s", tests.Failed, testID, logs.String(), spans.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould redact the token.", tests.Success, testID)
+
+			var span trace.SpanData
+			if err := json.Unmarshal(spans.Bytes(), &span); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the span: %v", tests.Failed, testID, err)
+			}
+			if span.Name != "dgraph query findUser" || span.StatusCode != trace.StatusOK || span.TraceID == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould export a span for the query: %+v", tests.Failed, testID, span)
+			}
+			t.Logf("\t%s\tTest %d:\tShould export a span for the query.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a mutation with literal values is traced.", testID)
+		{
+			var traceParent string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceParent = r.Header.Get("traceparent")
+				w.Write([]byte(`{"data":{"updateUser":{"numUids":1}}}`))
+			}))
+			defer srv.Close()
+
+			var spans bytes.Buffer
+			gqlConfig := data.GraphQLConfig{
+				URL: srv.URL,
+				Instrument: data.InstrumentConfig{
+					Tracer: trace.New(trace.NewJSONExporter(&spans)),
+				},
+			}
+			gql, err := data.NewGraphQL(gqlConfig)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+
+			mutation := `mutation { u0: updateUser(input: {filter: {id: ["0x1"]}, set: {name: "Bill \"B\" K", friends_count: 20, pagerank: -1.5e-3}}) { numUids } }`
+			if err := gql.Query(context.Background(), mutation, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the mutation: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to make the mutation.", tests.Success, testID)
+
+			var span trace.SpanData
+			if err := json.Unmarshal(spans.Bytes(), &span); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the span: %v", tests.Failed, testID, err)
+			}
+
+			exp := `mutation { u0: updateUser(input: {filter: {id: ["?"]}, set: {name: "?", friends_count: ?, pagerank: ?}}) { numUids } }`
+			if got := span.Attributes["db.statement"]; got != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould replace the literal values in the statement, got %v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replace the literal values in the statement.", tests.Success, testID)
+
+			if exp := "00-" + span.TraceID + "-" + span.SpanID + "-01"; traceParent != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould send the span as a traceparent, exp %q got %q.", tests.Failed, testID, exp, traceParent)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the span as a traceparent.", tests.Success, testID)
+		}
+	}
+}
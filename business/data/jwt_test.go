@@ -0,0 +1,89 @@
+package data_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestJWT validates requests carry a token signed with the claims from
+// their context.
+func TestJWT(t *testing.T) {
+	t.Log("Given the need to sign requests for the @auth rules.")
+	{
+		var tokens []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokens = append(tokens, r.Header.Get("X-Test-Auth"))
+			w.Write([]byte(`{"data":{}}`))
+		}))
+		defer srv.Close()
+
+		gqlConfig := data.GraphQLConfig{
+			URL:            srv.URL,
+			AuthHeaderName: "X-Test-Auth",
+			Signer:         data.NewSigner("test-key", "", time.Minute),
+			Claims:         data.Claims{Role: data.RoleAdmin},
+		}
+		gql, err := data.NewGraphQL(gqlConfig)
+		if err != nil {
+			t.Fatalf("\tShould be able to construct the client: %v", err)
+		}
+
+		table := []struct {
+			name   string
+			ctx    context.Context
+			claims data.Claims
+		}{
+			{"default", context.Background(), data.Claims{Role: data.RoleAdmin}},
+			{"context", data.WithClaims(context.Background(), data.Claims{UserID: "0x1", Role: data.RoleUser}), data.Claims{UserID: "0x1", Role: data.RoleUser}},
+		}
+
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen a request is made with the %s claims.", testID, tt.name)
+			{
+				tokens = nil
+				if err := gql.Query(tt.ctx, `query { queryUser { id } }`, nil); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to make the request: %v", tests.Failed, testID, err)
+				}
+				if len(tokens) != 1 {
+					t.Fatalf("\t%s\tTest %d:\tShould make a single request, got %d.", tests.Failed, testID, len(tokens))
+				}
+
+				parts := strings.Split(tokens[0], ".")
+				if len(parts) != 3 {
+					t.Fatalf("\t%s\tTest %d:\tShould send a token in the header: %q", tests.Failed, testID, tokens[0])
+				}
+				t.Logf("\t%s\tTest %d:\tShould send a token in the header.", tests.Success, testID)
+
+				mac := hmac.New(sha256.New, []byte("test-key"))
+				mac.Write([]byte(parts[0] + "." + parts[1]))
+				if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+					t.Fatalf("\t%s\tTest %d:\tShould sign the token with the key.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould sign the token with the key.", tests.Success, testID)
+
+				payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to decode the payload: %v", tests.Failed, testID, err)
+				}
+				var claims map[string]data.Claims
+				json.Unmarshal(payload, &claims)
+
+				if got := claims[data.DefaultNamespace]; got != tt.claims {
+					t.Fatalf("\t%s\tTest %d:\tShould carry the claims, exp %+v got %+v.", tests.Failed, testID, tt.claims, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould carry the claims.", tests.Success, testID)
+			}
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package ready
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Set of instance kinds a node can be.
+const (
+	Alpha = "alpha"
+	Zero  = "zero"
+)
+
+// Set of statuses a node can have. Nodes that Zero knows about but that
+// aren't in the health report are unreachable.
+const (
+	StatusHealthy     = "healthy"
+	StatusUnreachable = "unreachable"
+)
+
+// Node represents the health of a single node in the cluster. Uptime is in
+// seconds, as the database reports it.
+type Node struct {
+	Instance string    `json:"instance"`
+	Address  string    `json:"address"`
+	Status   string    `json:"status"`
+	Group    string    `json:"group"`
+	Version  string    `json:"version"`
+	Uptime   int64     `json:"uptime"`
+	LastEcho time.Time `json:"last_echo"`
+	Leader   bool      `json:"leader"`
+}
+
+// Healthy reports if the node is healthy.
+func (n Node) Healthy() bool {
+	return n.Status == StatusHealthy
+}
+
+// Group represents the alphas that serve the same predicates. Group 0 is
+// the group of the zeros.
+type Group struct {
+	ID      string   `json:"id"`
+	Members []string `json:"members"`
+	Leader  string   `json:"leader"`
+}
+
+// Report represents the health of every node in the cluster and how the
+// nodes are organized into groups.
+type Report struct {
+	Nodes  []Node  `json:"nodes"`
+	Groups []Group `json:"groups"`
+}
+
+// Alphas returns the alpha nodes in the report.
+func (r Report) Alphas() []Node {
+	return r.instances(Alpha)
+}
+
+// Zeros returns the zero nodes in the report.
+func (r Report) Zeros() []Node {
+	return r.instances(Zero)
+}
+
+// node returns the node with the specified address.
+func (r Report) node(address string) (Node, bool) {
+	for _, n := range r.Nodes {
+		if n.Address == address {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// instances returns the nodes of the specified kind.
+func (r Report) instances(instance string) []Node {
+	var nodes []Node
+	for _, n := range r.Nodes {
+		if n.Instance == instance {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// merge records what Zero knows about the node. A node Zero knows about
+// that isn't in the health report is added as unreachable.
+func (r *Report) merge(n Node) {
+	for i := range r.Nodes {
+		if r.Nodes[i].Address == n.Address {
+			r.Nodes[i].Leader = n.Leader
+			if r.Nodes[i].Group == "" {
+				r.Nodes[i].Group = n.Group
+			}
+			return
+		}
+	}
+
+	n.Status = StatusUnreachable
+	r.Nodes = append(r.Nodes, n)
+}
+
+// =============================================================================
+
+// Policy decides if the cluster described by the report is ready. It returns
+// an error describing why the cluster isn't ready.
+type Policy func(r Report) error
+
+// AllAlphas requires every alpha in the cluster to be healthy.
+func AllAlphas(r Report) error {
+	alphas := r.Alphas()
+	if len(alphas) == 0 {
+		return errors.New("no alphas reported")
+	}
+
+	for _, n := range alphas {
+		if !n.Healthy() {
+			return fmt.Errorf("alpha %s is %s", n.Address, n.Status)
+		}
+	}
+
+	return nil
+}
+
+// Quorum requires a majority of the alphas in every group and a majority of
+// the zeros to be healthy, which is what the cluster needs to keep serving
+// reads and writes.
+func Quorum(r Report) error {
+	var alphaGroups int
+	for _, g := range r.Groups {
+		var healthy int
+		for _, address := range g.Members {
+			if n, exists := r.node(address); exists && n.Healthy() {
+				healthy++
+			}
+		}
+
+		if healthy <= len(g.Members)/2 {
+			return fmt.Errorf("group %s has %d of %d members healthy", g.ID, healthy, len(g.Members))
+		}
+		if g.ID != "0" {
+			alphaGroups++
+		}
+	}
+
+	if alphaGroups == 0 {
+		return errors.New("no alpha groups reported")
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Check returns a report of the health of the cluster the alpha belongs to.
+// The health of every node is read from the alpha. When the url of Zero's
+// http endpoint is provided, the groups and their leaders are read from
+// Zero, otherwise the groups are derived from the health of the alphas and
+// the leaders are unknown. The client must connect with the TLS settings and
+// credentials the cluster requires.
+func Check(ctx context.Context, client *http.Client, alphaURL string, zeroURL string) (Report, error) {
+	var health []struct {
+		Instance string `json:"instance"`
+		Address  string `json:"address"`
+		Status   string `json:"status"`
+		Group    string `json:"group"`
+		Version  string `json:"version"`
+		Uptime   int64  `json:"uptime"`
+		LastEcho int64  `json:"lastEcho"`
+	}
+	if err := get(ctx, client, alphaURL, "/health?all", &health); err != nil {
+		return Report{}, errors.Wrap(err, "retrieving health")
+	}
+
+	var report Report
+	for _, h := range health {
+		n := Node{
+			Instance: h.Instance,
+			Address:  h.Address,
+			Status:   h.Status,
+			Group:    h.Group,
+			Version:  h.Version,
+			Uptime:   h.Uptime,
+		}
+		if h.LastEcho != 0 {
+			n.LastEcho = time.Unix(h.LastEcho, 0).UTC()
+		}
+		report.Nodes = append(report.Nodes, n)
+	}
+
+	if zeroURL == "" {
+		report.Groups = groupsFromHealth(report.Nodes)
+		return report, nil
+	}
+
+	type member struct {
+		Addr   string `json:"addr"`
+		Leader bool   `json:"leader"`
+	}
+	var state struct {
+		Groups map[string]struct {
+			Members map[string]member `json:"members"`
+		} `json:"groups"`
+		Zeros map[string]member `json:"zeros"`
+	}
+	if err := get(ctx, client, zeroURL, "/state", &state); err != nil {
+		return Report{}, errors.Wrap(err, "retrieving state")
+	}
+
+	members := map[string]map[string]member{"0": state.Zeros}
+	ids := []string{"0"}
+	for id, g := range state.Groups {
+		members[id] = g.Members
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+
+	for _, id := range ids {
+		group := Group{ID: id}
+		instance := Alpha
+		if id == "0" {
+			instance = Zero
+		}
+
+		raftIDs := make([]string, 0, len(members[id]))
+		for raftID := range members[id] {
+			raftIDs = append(raftIDs, raftID)
+		}
+		sortIDs(raftIDs)
+
+		for _, raftID := range raftIDs {
+			m := members[id][raftID]
+			group.Members = append(group.Members, m.Addr)
+			if m.Leader {
+				group.Leader = m.Addr
+			}
+			report.merge(Node{Instance: instance, Address: m.Addr, Group: id, Leader: m.Leader})
+		}
+
+		report.Groups = append(report.Groups, group)
+	}
+
+	return report, nil
+}
+
+// ValidateCluster checks the health of the cluster until the policy holds.
+// It will attempt a check between each retry interval specified. The context
+// holds the total amount of time to wait. The last report is returned along
+// with the reason the cluster isn't ready when the wait times out.
+func ValidateCluster(ctx context.Context, client *http.Client, alphaURL string, zeroURL string, policy Policy, retryInterval time.Duration) (Report, error) {
+	var report Report
+	err := retry(ctx, retryInterval, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+
+		r, err := Check(ctx, client, alphaURL, zeroURL)
+		if err != nil {
+			return err
+		}
+		report = r
+
+		return policy(r)
+	})
+
+	return report, err
+}
+
+// groupsFromHealth returns the groups the nodes say they belong to.
+func groupsFromHealth(nodes []Node) []Group {
+	members := make(map[string][]string)
+	var ids []string
+	for _, n := range nodes {
+		id := n.Group
+		if n.Instance == Zero {
+			id = "0"
+		}
+		if _, exists := members[id]; !exists {
+			ids = append(ids, id)
+		}
+		members[id] = append(members[id], n.Address)
+	}
+	sortIDs(ids)
+
+	var groups []Group
+	for _, id := range ids {
+		groups = append(groups, Group{ID: id, Members: members[id]})
+	}
+	return groups
+}
+
+// sortIDs orders group and raft ids numerically.
+func sortIDs(ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+}
+
+// get decodes the json document served at the path.
+func get(ctx context.Context, client *http.Client, url string, path string, v interface{}) error {
+	url = strings.TrimRight(url, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
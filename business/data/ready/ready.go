@@ -16,20 +16,32 @@ import (
 // Validate checks if the DB is ready to receive requests. It will attempt
 // a check between each retry interval specified. The context holds the
 // total amount of time Readiness will wait to validate the DB is healthy.
-func Validate(ctx context.Context, url string, retryInterval time.Duration) error {
+// The client must connect with the TLS settings and credentials the cluster
+// requires.
+func Validate(ctx context.Context, client *http.Client, url string, retryInterval time.Duration) error {
+	return retry(ctx, retryInterval, func(ctx context.Context) error {
+		return checkDB(ctx, client, url)
+	})
+}
+
+// retry calls the check function between each retry interval until it
+// succeeds or the context is done. The error of the last check is reported
+// when the context is done.
+func retry(ctx context.Context, retryInterval time.Duration, check func(ctx context.Context) error) error {
 	var t *time.Timer
 
 	// We will try until the context timeout has expired.
 	for {
 
 		// If there is no error, then report health.
-		if err := checkDB(ctx, url); err == nil {
+		err := check(ctx)
+		if err == nil {
 			return nil
 		}
 
 		// Check if the timeout has expired.
 		if ctx.Err() != nil {
-			return errors.Wrap(ctx.Err(), "timed out")
+			return errors.Wrapf(ctx.Err(), "timed out: %v", err)
 		}
 
 		// Create the timer if one doesn't exist.
@@ -41,7 +53,7 @@ func Validate(ctx context.Context, url string, retryInterval time.Duration) erro
 		select {
 		case <-ctx.Done():
 			t.Stop()
-			return errors.Wrap(ctx.Err(), "timed out")
+			return errors.Wrapf(ctx.Err(), "timed out: %v", err)
 		case <-t.C:
 			t.Reset(retryInterval)
 		}
@@ -49,7 +61,7 @@ func Validate(ctx context.Context, url string, retryInterval time.Duration) erro
 }
 
 // checkDB attempts to validate if the database is ready.
-func checkDB(ctx context.Context, url string) error {
+func checkDB(ctx context.Context, client *http.Client, url string) error {
 	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
 	defer cancel()
 
@@ -59,7 +71,7 @@ func checkDB(ctx context.Context, url string) error {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,168 @@
+package ready_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data/ready"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// cluster mimics the health endpoint of an alpha and the state endpoint of
+// zero for a cluster with one zero, three alphas in group 1 and a dead alpha
+// in group 2 that only zero knows about. The third alpha becomes healthy
+// after unhealthyFor health checks.
+type cluster struct {
+	unhealthyFor int
+
+	mu     sync.Mutex
+	checks int
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (c *cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/health":
+		if _, all := r.URL.Query()["all"]; !all {
+			http.Error(w, "only all", http.StatusBadRequest)
+			return
+		}
+
+		c.checks++
+		status := "healthy"
+		if c.checks <= c.unhealthyFor {
+			status = "unhealthy"
+		}
+
+		fmt.Fprintf(w, `[
+			{"instance":"zero","address":"zero1:5080","status":"healthy","group":"0","version":"v20.11.0","uptime":120,"lastEcho":1600000000},
+			{"instance":"alpha","address":"alpha1:7080","status":"healthy","group":"1","version":"v20.11.0","uptime":100,"lastEcho":1600000000},
+			{"instance":"alpha","address":"alpha2:7080","status":"healthy","group":"1","version":"v20.11.0","uptime":90,"lastEcho":1600000000},
+			{"instance":"alpha","address":"alpha3:7080","status":%q,"group":"1","version":"v20.11.0","uptime":5,"lastEcho":1600000000}
+		]`, status)
+
+	case "/state":
+		w.Write([]byte(`{
+			"counter":"12",
+			"groups":{
+				"1":{"members":{
+					"1":{"id":"1","groupId":1,"addr":"alpha1:7080","leader":true},
+					"2":{"id":"2","groupId":1,"addr":"alpha2:7080"},
+					"3":{"id":"3","groupId":1,"addr":"alpha3:7080"}
+				}},
+				"2":{"members":{
+					"4":{"id":"4","groupId":2,"addr":"alpha4:7080","leader":true,"amDead":true}
+				}}
+			},
+			"zeros":{"1":{"id":"1","addr":"zero1:5080","leader":true}}
+		}`))
+	}
+}
+
+// TestCluster validates the health of every node in the cluster is reported
+// and the policies decide if the cluster is ready.
+func TestCluster(t *testing.T) {
+	t.Log("Given the need to know the health of the whole cluster.")
+	{
+		c := cluster{unhealthyFor: 1}
+		srv := httptest.NewServer(&c)
+		defer srv.Close()
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen an alpha is unhealthy and another is unreachable.", testID)
+		{
+			report, err := ready.Check(context.Background(), srv.Client(), srv.URL, srv.URL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check the cluster: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to check the cluster.", tests.Success, testID)
+
+			if len(report.Zeros()) != 1 || len(report.Alphas()) != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould report every node, got %d zeros and %d alphas.", tests.Failed, testID, len(report.Zeros()), len(report.Alphas()))
+			}
+			t.Logf("\t%s\tTest %d:\tShould report every node.", tests.Success, testID)
+
+			alpha1 := report.Alphas()[0]
+			if !alpha1.Leader || alpha1.Version != "v20.11.0" || alpha1.Uptime != 100 {
+				t.Fatalf("\t%s\tTest %d:\tShould report the leader, version and uptime: %+v", tests.Failed, testID, alpha1)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the leader, version and uptime.", tests.Success, testID)
+
+			data, err := json.Marshal(alpha1)
+			if err != nil || !strings.Contains(string(data), `"uptime":100,`) {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the uptime in seconds: %s", tests.Failed, testID, data)
+			}
+			t.Logf("\t%s\tTest %d:\tShould encode the uptime in seconds.", tests.Success, testID)
+
+			alpha4 := report.Alphas()[3]
+			if alpha4.Address != "alpha4:7080" || alpha4.Status != ready.StatusUnreachable || alpha4.Group != "2" {
+				t.Fatalf("\t%s\tTest %d:\tShould report nodes zero knows about as unreachable: %+v", tests.Failed, testID, alpha4)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report nodes zero knows about as unreachable.", tests.Success, testID)
+
+			if len(report.Groups) != 3 || report.Groups[1].ID != "1" || report.Groups[1].Leader != "alpha1:7080" || len(report.Groups[1].Members) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould report the groups: %+v", tests.Failed, testID, report.Groups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the groups.", tests.Success, testID)
+
+			if err := ready.AllAlphas(report); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be ready by the all alphas policy.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be ready by the all alphas policy.", tests.Success, testID)
+
+			if err := ready.Quorum(report); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be ready by the quorum policy without group 2.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be ready by the quorum policy without group 2.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen zero isn't consulted.", testID)
+		{
+			c.unhealthyFor = c.checks + 1
+
+			report, err := ready.Check(context.Background(), srv.Client(), srv.URL, "")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check the cluster: %v", tests.Failed, testID, err)
+			}
+
+			if len(report.Groups) != 2 || len(report.Groups[1].Members) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould derive the groups from the health: %+v", tests.Failed, testID, report.Groups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould derive the groups from the health.", tests.Success, testID)
+
+			if err := ready.Quorum(report); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be ready by the quorum policy: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be ready by the quorum policy.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen waiting for every alpha to be healthy.", testID)
+		{
+			c.unhealthyFor = c.checks + 2
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			report, err := ready.ValidateCluster(ctx, srv.Client(), srv.URL, "", ready.AllAlphas, 10*time.Millisecond)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould see the cluster become ready: %v", tests.Failed, testID, err)
+			}
+			if err := ready.AllAlphas(report); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould return the report of the ready cluster: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the cluster become ready.", tests.Success, testID)
+		}
+	}
+}
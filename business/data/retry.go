@@ -0,0 +1,246 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the database when too many
+// requests in a row have failed and the database is assumed to be down.
+var ErrCircuitOpen = errors.New("circuit open: dgraph is unavailable")
+
+// metrics exposes how often requests had to be retried or were rejected and
+// how often subscriptions had to be started again.
+var metrics = expvar.NewMap("dgraph")
+
+// RetryConfig represents the policy for retrying failed requests. Queries
+// that fail because the database is unavailable are retried up to Attempts
+// times, waiting Backoff before the first retry and doubling the wait up to
+// MaxBackoff. Requests of any kind are retried when their transaction was
+// aborted, unless they are part of a transaction the caller controls. Once
+// Threshold requests in a row have failed, requests fail fast with
+// ErrCircuitOpen until Cooldown has passed. Zero values use defaults and
+// negative Attempts disables retrying.
+type RetryConfig struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Threshold  int
+	Cooldown   time.Duration
+}
+
+// =============================================================================
+
+// retryTransport retries the requests that failed for reasons that are
+// likely to go away and fails fast when the database is down.
+type retryTransport struct {
+	next    http.RoundTripper
+	cfg     RetryConfig
+	breaker *breaker
+}
+
+// newRetryTransport constructs a retryTransport, applying the defaults for
+// any setting that isn't provided.
+func newRetryTransport(next http.RoundTripper, cfg RetryConfig) *retryTransport {
+	switch {
+	case cfg.Attempts == 0:
+		cfg.Attempts = 8
+	case cfg.Attempts < 0:
+		cfg.Attempts = 0
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 250 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 4 * time.Second
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+
+	rt := retryTransport{
+		next:    next,
+		cfg:     cfg,
+		breaker: &breaker{threshold: cfg.Threshold, cooldown: cfg.Cooldown},
+	}
+	return &rt
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.breaker.allow() {
+		metrics.Add("rejected", 1)
+		return nil, ErrCircuitOpen
+	}
+
+	// The body has to be sent again on every attempt.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	idempotent := isQuery(path.Base(req.URL.Path), body)
+
+	// An abort inside a transaction aborts the whole transaction, so only
+	// the caller can retry it.
+	inTxn := req.URL.Query().Get("startTs") != ""
+
+	ctx := req.Context()
+	wait := rt.cfg.Backoff
+
+	for attempt := 0; ; attempt++ {
+		r := req.Clone(ctx)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		resp, err := rt.next.RoundTrip(r)
+
+		var conflict *ConflictError
+		aborted := errors.As(err, &conflict) && !inTxn
+		transient := unavailable(resp, err)
+
+		if !aborted && (!transient || !idempotent) || attempt == rt.cfg.Attempts || ctx.Err() != nil {
+			// The caller giving up says nothing about the database, so it
+			// must not reset the failures counted so far.
+			if err != nil && ctx.Err() != nil {
+				rt.breaker.release()
+				return resp, err
+			}
+
+			rt.breaker.record(transient)
+			if transient {
+				metrics.Add("failures", 1)
+			}
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if aborted {
+			metrics.Add("aborts", 1)
+		}
+		metrics.Add("retries", 1)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			rt.breaker.release()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		if wait *= 2; wait > rt.cfg.MaxBackoff {
+			wait = rt.cfg.MaxBackoff
+		}
+	}
+}
+
+// unavailable reports if the request failed because the database couldn't
+// serve it, as opposed to rejecting it or the caller giving up.
+func unavailable(resp *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if err != nil {
+		var dErr *Error
+		if !errors.As(err, &dErr) {
+			return true
+		}
+		var notReady *NotReadyError
+		return errors.As(err, &notReady)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// isQuery reports if the request only reads data and can be safely sent
+// more than once.
+func isQuery(command string, body []byte) bool {
+	switch command {
+	case "query":
+		return true
+	case "graphql", "admin":
+		var request struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return false
+		}
+		return !strings.HasPrefix(strings.TrimSpace(request.Query), "mutation")
+	}
+	return false
+}
+
+// =============================================================================
+
+// breaker tracks the requests that failed in a row. Once the threshold is
+// reached it opens and rejects requests until the cooldown has passed. Then
+// a single request is let through to find out if the database is back.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports if a request can be sent to the database.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+// release lets another request probe the database without recording an
+// outcome, for a request that was abandoned by the caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// record tracks the outcome of a request that was allowed through.
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		metrics.Add("breaker_opened", 1)
+	}
+}
@@ -0,0 +1,175 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestRetry validates failed requests are retried and the client fails fast
+// when the database is down.
+func TestRetry(t *testing.T) {
+	t.Log("Given the need to survive transient database failures.")
+	{
+		// fail constructs a server that fails the first n requests with the
+		// specified response and answers every other one.
+		fail := func(n int32, status int, body string) (*httptest.Server, *int32) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= n {
+					w.WriteHeader(status)
+					w.Write([]byte(body))
+					return
+				}
+				w.Write([]byte(`{"data":{}}`))
+			}))
+			return srv, &calls
+		}
+
+		retry := data.RetryConfig{
+			Attempts:   3,
+			Backoff:    time.Millisecond,
+			MaxBackoff: time.Millisecond,
+			Threshold:  2,
+			Cooldown:   time.Hour,
+		}
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a query fails while the database isn't ready.", testID)
+		{
+			srv, calls := fail(2, http.StatusOK, `{"errors":[{"message":"Server not ready"}]}`)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: retry})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+			if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query once the database is ready: %v", tests.Failed, testID, err)
+			}
+			if *calls != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould retry the query twice, got %d calls.", tests.Failed, testID, *calls)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retry the query until the database is ready.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a mutation fails with a server error.", testID)
+		{
+			srv, calls := fail(1, http.StatusInternalServerError, ``)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: retry})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+			if err := gql.Query(context.Background(), `mutation { deleteUser(filter: {}) { msg } }`, nil); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the mutation.", tests.Failed, testID)
+			}
+			if *calls != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould not retry the mutation, got %d calls.", tests.Failed, testID, *calls)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not retry the mutation.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a mutation's transaction is aborted.", testID)
+		{
+			srv, calls := fail(1, http.StatusOK, `{"errors":[{"message":"Transaction has been aborted. Please retry"}]}`)
+			defer srv.Close()
+
+			aborts := counter("aborts")
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: retry})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+			if err := gql.Query(context.Background(), `mutation { deleteUser(filter: {}) { msg } }`, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retry the mutation: %v", tests.Failed, testID, err)
+			}
+			if *calls != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould retry the mutation once, got %d calls.", tests.Failed, testID, *calls)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retry the mutation.", tests.Success, testID)
+
+			if got := counter("aborts"); got != aborts+1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the abort, exp %d got %d.", tests.Failed, testID, aborts+1, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the abort.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the database keeps failing.", testID)
+		{
+			srv, calls := fail(100, http.StatusServiceUnavailable, ``)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: retry})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+			for i := 0; i < retry.Threshold; i++ {
+				if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould fail the query.", tests.Failed, testID)
+				}
+			}
+			made := *calls
+
+			err = gql.Query(context.Background(), `query { queryUser { id } }`, nil)
+			if !errors.Is(err, data.ErrCircuitOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail fast once the circuit is open: %v", tests.Failed, testID, err)
+			}
+			if *calls != made {
+				t.Fatalf("\t%s\tTest %d:\tShould not contact the database once the circuit is open.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail fast once the circuit is open.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen a request is cancelled between failures.", testID)
+		{
+			srv, _ := fail(100, http.StatusServiceUnavailable, ``)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, Retry: retry})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+			if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the query.", tests.Failed, testID)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := gql.Query(ctx, `query { queryUser { id } }`, nil); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the cancelled query.", tests.Failed, testID)
+			}
+
+			if err := gql.Query(context.Background(), `query { queryUser { id } }`, nil); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the query.", tests.Failed, testID)
+			}
+			err = gql.Query(context.Background(), `query { queryUser { id } }`, nil)
+			if !errors.Is(err, data.ErrCircuitOpen) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep counting the failures around a cancelled request: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep counting the failures around a cancelled request.", tests.Success, testID)
+		}
+	}
+}
+
+// counter returns the current value of the specified client metric.
+func counter(name string) int64 {
+	v, ok := expvar.Get("dgraph").(*expvar.Map).Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return v.Value()
+}
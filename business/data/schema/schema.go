@@ -3,46 +3,90 @@ package schema
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/ardanlabs/dgraph/business/data"
 	"github.com/ardanlabs/graphql"
 	"github.com/pkg/errors"
 )
 
 // document represents the schema for the project.
 var document = `
-type User {
+type User @withSubscription @auth(
+	update: { or: [
+		{ rule: "{$ROLE: { eq: \"ADMIN\" } }" },
+		{ rule: """query($USER: ID!) { queryUser(filter: { id: [$USER] }) { id } }""" }
+	]}
+) {
 	id: ID!
-	source_id: String!
-	source: String!
+	key: String! @id
+	source_id: String! @search(by: [exact])
+	source: String! @search(by: [exact])
 	screen_name: String! @search(by: [exact])
 	name: String!
 	location: String
 	friends_count: Int
+	last_synced: DateTime @search(by: [hour])
 	friends: [User]
+	past_friends: [User]
+	follows: [Follow] @hasInverse(field: follower)
+	pagerank: Float @search
+	in_degree: Int @search
+	out_degree: Int
+	betweenness: Float
+	community: Int @search
+}
+
+type Follow {
+	id: ID!
+	key: String! @search(by: [exact])
+	follower: User!
+	friend: User!
+	since: DateTime! @search(by: [hour])
+	until: DateTime @search(by: [hour])
 }
 `
 
+// Version returns an identifier for the schema document. It changes every
+// time the document changes.
+func Version() string {
+	sum := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(sum[:6])
+}
+
 // Schema error variables.
 var (
 	ErrNoSchemaExists = errors.New("no schema exists")
 	ErrInvalidSchema  = errors.New("schema doesn't match")
 )
 
+// Authorization represents how Dgraph verifies the tokens the @auth rules
+// are evaluated against. The tokens are HS256 signed with the key, sent in
+// the header and carry the custom claims under the namespace.
+type Authorization struct {
+	Header    string
+	Namespace string
+	Key       string
+}
+
 // Schema provides support for schema operations against the database.
 type Schema struct {
 	graphql  *graphql.GraphQL
 	document string
 }
 
-// New constructs a Schema value for use to manage the schema.
-func New(graphql *graphql.GraphQL) *Schema {
+// New constructs a Schema value for use to manage the schema. Only admins
+// and the user themselves can update a user, which requires the
+// authorization to be configured.
+func New(graphql *graphql.GraphQL, auth Authorization) *Schema {
 	schema := Schema{
 		graphql:  graphql,
-		document: document,
+		document: document + authorization(auth),
 	}
 
 	return &schema
@@ -120,12 +164,15 @@ func (s *Schema) Create(ctx context.Context) error {
 }
 
 // retrieve queries the database for the schema and handles situations
-// when the database is not ready for schema operations.
+// when the database is not ready for schema operations. The client only
+// retries a few times, so a database that is still starting is waited on
+// until the context deadline.
 func (s *Schema) retrieve(ctx context.Context) (string, error) {
 	for {
 		schema, err := s.query(ctx)
 		if err != nil {
-			if strings.Contains(err.Error(), "Server not ready") {
+			var notReady *data.NotReadyError
+			if errors.As(err, &notReady) || errors.Is(err, data.ErrCircuitOpen) {
 
 				// If the context deadline exceeded then we are done trying.
 				if ctx.Err() != nil {
@@ -133,7 +180,11 @@ func (s *Schema) retrieve(ctx context.Context) (string, error) {
 				}
 
 				// We need to wait for the server to be ready for this :(.
-				time.Sleep(2 * time.Second)
+				select {
+				case <-time.After(2 * time.Second):
+				case <-ctx.Done():
+					return "", errors.Wrap(err, "server not ready")
+				}
 				continue
 			}
 
@@ -159,6 +210,32 @@ func (s *Schema) query(ctx context.Context) (string, error) {
 	return string(data), nil
 }
 
+// authorization returns the line that configures how Dgraph verifies tokens.
+func authorization(auth Authorization) string {
+	if auth.Key == "" {
+		return ""
+	}
+
+	meta := struct {
+		VerificationKey string
+		Header          string
+		Namespace       string
+		Algo            string
+	}{
+		VerificationKey: auth.Key,
+		Header:          auth.Header,
+		Namespace:       auth.Namespace,
+		Algo:            "HS256",
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return ""
+	}
+
+	return "# Dgraph.Authorization " + string(data) + "\n"
+}
+
 func (s *Schema) validate(ctx context.Context, schema string) error {
 	if schema == `{"getGQLSchema":null}` || schema == `{"getGQLSchema":{"schema":""}}` {
 		return ErrNoSchemaExists
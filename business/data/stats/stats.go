@@ -0,0 +1,261 @@
+// Package stats provides support for summarizing what is stored in the
+// database. Every number is computed by Dgraph with aggregate DQL queries so
+// no user has to be fetched.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Config represents the settings for retrieving the stats. Users that have
+// been synced and are missing at least MinMissing of the friends the source
+// reported are considered partially crawled.
+type Config struct {
+	Top        int
+	MinMissing int
+}
+
+// Stats represents a summary of the graph stored in the database.
+type Stats struct {
+	Users     int            `json:"users"`
+	BySource  map[string]int `json:"by_source"`
+	Edges     int            `json:"edges"`
+	Isolated  int            `json:"isolated"`
+	InDegree  []Bucket       `json:"in_degree"`
+	OutDegree []Bucket       `json:"out_degree"`
+	TopIn     []Account      `json:"top_in"`
+	TopOut    []Account      `json:"top_out"`
+	Partial   []Account      `json:"partial"`
+}
+
+// Bucket represents the number of users with a degree in [Min, Max].
+type Bucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Users int `json:"users"`
+}
+
+// Account represents a user reported by the stats along with the number
+// the user was reported for.
+type Account struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	ScreenName   string `json:"screen_name"`
+	Degree       int    `json:"degree,omitempty"`
+	FriendsCount int    `json:"friends_count,omitempty"`
+	Stored       int    `json:"stored,omitempty"`
+	Missing      int    `json:"missing,omitempty"`
+}
+
+// Retrieve computes the stats for the graph stored in the database.
+func Retrieve(ctx context.Context, gql *graphql.GraphQL, cfg Config) (Stats, error) {
+	if cfg.Top <= 0 {
+		cfg.Top = 10
+	}
+	if cfg.MinMissing <= 0 {
+		cfg.MinMissing = 1
+	}
+
+	query := fmt.Sprintf(`
+{
+	%s
+	var(func: type(User)) {
+		reported as User.friends_count
+		missing as math(reported - out)
+	}
+	sources(func: type(User)) @groupby(User.source) {
+		count(uid)
+	}
+	totals() {
+		edges: sum(val(out))
+		max_out: max(val(out))
+		max_in: max(val(in))
+	}
+	isolated(func: type(User)) @filter(NOT has(User.friends) AND NOT uid(in)) {
+		count(uid)
+	}
+	top_in(func: uid(in), orderdesc: val(in), first: %d) {
+		uid
+		User.source
+		User.screen_name
+		degree: val(in)
+	}
+	top_out(func: uid(out), orderdesc: val(out), first: %d) @filter(gt(val(out), 0)) {
+		uid
+		User.source
+		User.screen_name
+		degree: val(out)
+	}
+	partial(func: uid(missing), orderdesc: val(missing), first: %d) @filter(has(User.last_synced) AND ge(val(missing), %d)) {
+		uid
+		User.source
+		User.screen_name
+		User.friends_count
+		stored: val(out)
+		missing: val(missing)
+	}
+}`, vars, cfg.Top, cfg.Top, cfg.Top, cfg.MinMissing)
+
+	var result struct {
+		Sources []struct {
+			GroupBy []struct {
+				Source string `json:"User.source"`
+				Count  int    `json:"count"`
+			} `json:"@groupby"`
+		} `json:"sources"`
+		Totals   []map[string]int `json:"totals"`
+		Isolated []struct {
+			Count int `json:"count"`
+		} `json:"isolated"`
+		TopIn   []account `json:"top_in"`
+		TopOut  []account `json:"top_out"`
+		Partial []account `json:"partial"`
+	}
+	if err := gql.QueryPM(ctx, query, &result); err != nil {
+		return Stats{}, errors.Wrap(err, "query failed")
+	}
+
+	stats := Stats{
+		BySource: make(map[string]int),
+	}
+	for _, s := range result.Sources {
+		for _, g := range s.GroupBy {
+			stats.BySource[g.Source] = g.Count
+			stats.Users += g.Count
+		}
+	}
+
+	// Each aggregate of a block without a root function comes back as
+	// its own object.
+	totals := make(map[string]int)
+	for _, t := range result.Totals {
+		for k, v := range t {
+			totals[k] = v
+		}
+	}
+	stats.Edges = totals["edges"]
+
+	if len(result.Isolated) > 0 {
+		stats.Isolated = result.Isolated[0].Count
+	}
+
+	stats.TopIn = accounts(result.TopIn)
+	stats.TopOut = accounts(result.TopOut)
+	stats.Partial = accounts(result.Partial)
+
+	var err error
+	stats.InDegree, stats.OutDegree, err = histograms(ctx, gql, stats.Users, totals["max_in"], totals["max_out"])
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// =============================================================================
+
+// vars defines the value variables every query uses. The out-degree of a
+// user is the number of friends stored, the in-degree is the number of
+// users that store the user as a friend.
+const vars = `var(func: type(User)) {
+		out as count(User.friends)
+	}
+	var(func: type(User)) @groupby(User.friends) {
+		in as count(uid)
+	}`
+
+// account represents a user as returned by the queries.
+type account struct {
+	UID          string `json:"uid"`
+	Source       string `json:"User.source"`
+	ScreenName   string `json:"User.screen_name"`
+	FriendsCount int    `json:"User.friends_count"`
+	Degree       int    `json:"degree"`
+	Stored       int    `json:"stored"`
+	Missing      int    `json:"missing"`
+}
+
+// accounts converts the users returned by a query.
+func accounts(list []account) []Account {
+	out := make([]Account, len(list))
+	for i, a := range list {
+		out[i] = Account{
+			ID:           a.UID,
+			Source:       a.Source,
+			ScreenName:   a.ScreenName,
+			Degree:       a.Degree,
+			FriendsCount: a.FriendsCount,
+			Stored:       a.Stored,
+			Missing:      a.Missing,
+		}
+	}
+	return out
+}
+
+// buckets returns the degree ranges for a histogram up to the specified
+// maximum. Zero has its own bucket and every other bucket doubles in size.
+func buckets(max int) []Bucket {
+	list := []Bucket{{Min: 0, Max: 0}}
+	for min := 1; min <= max; min *= 2 {
+		list = append(list, Bucket{Min: min, Max: min*2 - 1})
+	}
+	return list
+}
+
+// histograms counts the users in every in-degree and out-degree bucket.
+func histograms(ctx context.Context, gql *graphql.GraphQL, users int, maxIn int, maxOut int) (in []Bucket, out []Bucket, err error) {
+	in = buckets(maxIn)
+	out = buckets(maxOut)
+
+	// Users without followers have no in-degree value, so that bucket is
+	// whatever is left once the followed users are counted.
+	blocks := []string{`followed(func: uid(in)) {
+		count(uid)
+	}`}
+	for i, b := range in[1:] {
+		blocks = append(blocks, fmt.Sprintf(`in_%d(func: uid(in)) @filter(ge(val(in), %d) AND le(val(in), %d)) {
+		count(uid)
+	}`, i+1, b.Min, b.Max))
+	}
+	for i, b := range out {
+		blocks = append(blocks, fmt.Sprintf(`out_%d(func: uid(out)) @filter(ge(val(out), %d) AND le(val(out), %d)) {
+		count(uid)
+	}`, i, b.Min, b.Max))
+	}
+
+	query := fmt.Sprintf(`
+{
+	%s
+	%s
+}`, vars, strings.Join(blocks, "\n\t"))
+
+	var result map[string][]struct {
+		Count int `json:"count"`
+	}
+	if err := gql.QueryPM(ctx, query, &result); err != nil {
+		return nil, nil, errors.Wrap(err, "query failed")
+	}
+
+	count := func(name string) int {
+		if list := result[name]; len(list) > 0 {
+			return list[0].Count
+		}
+		return 0
+	}
+
+	in[0].Users = users - count("followed")
+	for i := 1; i < len(in); i++ {
+		in[i].Users = count(fmt.Sprintf("in_%d", i))
+	}
+
+	for i := range out {
+		out[i].Users = count(fmt.Sprintf("out_%d", i))
+	}
+
+	return in, out, nil
+}
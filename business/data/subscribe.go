@@ -0,0 +1,444 @@
+package data
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/graphql"
+)
+
+// wsProtocol is the subprotocol Dgraph serves subscriptions with.
+const wsProtocol = "graphql-ws"
+
+// subscriptionID identifies the only operation started on a connection.
+const subscriptionID = "1"
+
+// defaultKeepAlive is how long a subscription waits for a message when the
+// configuration doesn't say. Dgraph sends a keep alive every few seconds.
+const defaultKeepAlive = time.Minute
+
+// Subscriber provides support for GraphQL subscriptions over the graphql-ws
+// WebSocket protocol. Every subscription gets a connection of its own.
+type Subscriber struct {
+	url        string
+	tls        *tls.Config
+	header     string
+	token      string
+	signer     *Signer
+	claims     Claims
+	session    *session
+	backoff    time.Duration
+	maxBackoff time.Duration
+	keepAlive  time.Duration
+	log        *log.Logger
+}
+
+// NewSubscriber constructs a Subscriber for use to subscribe to changes in
+// the database. Connections are made with the same settings as NewGraphQL.
+// When a connection is lost, the subscription is started again on a new one
+// with the backoff of the retry policy in the configuration. A connection
+// that goes quiet for longer than the keep alive is treated as lost.
+func NewSubscriber(gqlConfig GraphQLConfig) (*Subscriber, error) {
+	tlsConfig, err := loadTLS(gqlConfig.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("loading tls config: %w", err)
+	}
+
+	endpoint := strings.TrimRight(gqlConfig.URL, "/") + "/graphql"
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		endpoint = "wss://" + strings.TrimPrefix(endpoint, "https://")
+	case strings.HasPrefix(endpoint, "http://"):
+		endpoint = "ws://" + strings.TrimPrefix(endpoint, "http://")
+	}
+
+	var sess *session
+	if gqlConfig.ACL.User != "" {
+		bare, err := newBareTransport(gqlConfig.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if sess, err = newSession(gqlConfig.URL, gqlConfig.ACL, bare); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := gqlConfig.Retry.Backoff
+	if backoff <= 0 {
+		backoff = 250 * time.Millisecond
+	}
+	maxBackoff := gqlConfig.Retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 4 * time.Second
+	}
+	keepAlive := gqlConfig.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAlive
+	}
+
+	sub := Subscriber{
+		url:        endpoint,
+		tls:        tlsConfig,
+		header:     gqlConfig.AuthHeaderName,
+		token:      gqlConfig.AuthToken,
+		signer:     gqlConfig.Signer,
+		claims:     gqlConfig.Claims,
+		session:    sess,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		keepAlive:  keepAlive,
+		log:        gqlConfig.Instrument.Log,
+	}
+	return &sub, nil
+}
+
+// Push represents a result the database pushed to a subscription. Err is
+// set instead on the last push when the database rejected the subscription.
+type Push struct {
+	Data json.RawMessage
+	Err  error
+}
+
+// SubscriberFor constructs a Subscriber with the configuration the graphql
+// value was constructed with by NewGraphQL.
+func SubscriberFor(gql *graphql.GraphQL) (*Subscriber, error) {
+	gqlConfig, exists := configOf(gql)
+	if !exists {
+		return nil, errors.New("graphql value not constructed by NewGraphQL")
+	}
+	return NewSubscriber(gqlConfig)
+}
+
+// Subscribe starts the subscription and returns a channel that receives the
+// data of every result the database pushes, starting with the current one.
+// An error is returned if the first result can't be obtained. After that a
+// lost connection is made again and the subscription restarted, so a result
+// may be received more than once. When the database rejects the subscription
+// for any reason other than not being ready, restarting it won't help, so
+// the error is sent and the channel closed. The channel is also closed when
+// the context is canceled.
+func (s *Subscriber) Subscribe(ctx context.Context, query string, vars map[string]interface{}) (<-chan Push, error) {
+	conn, first, err := s.start(ctx, query, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Push)
+	go func() {
+		defer close(ch)
+
+		for {
+			err := s.receive(ctx, conn, first, ch)
+			conn.Close()
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !rejected(err) {
+				s.logf("dgraph: subscription: connection lost: %v", err)
+				conn, first, err = s.restart(ctx, query, vars)
+			}
+			if err != nil {
+				if rejected(err) {
+					s.logf("dgraph: subscription: rejected: %v", err)
+					select {
+					case ch <- Push{Err: err}:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// restart starts the subscription on a new connection, backing off between
+// attempts until it succeeds, the database rejects it or the context is
+// canceled.
+func (s *Subscriber) restart(ctx context.Context, query string, vars map[string]interface{}) (*wsConn, json.RawMessage, error) {
+	wait := s.backoff
+
+	for {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+
+		conn, first, err := s.start(ctx, query, vars)
+		if err == nil {
+			metrics.Add("resubscribes", 1)
+			return conn, first, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if rejected(err) {
+			return nil, nil, err
+		}
+		s.logf("dgraph: subscription: reconnecting: %v", err)
+
+		if wait *= 2; wait > s.maxBackoff {
+			wait = s.maxBackoff
+		}
+	}
+}
+
+// start connects, starts the subscription and waits for the first result.
+func (s *Subscriber) start(ctx context.Context, query string, vars map[string]interface{}) (*wsConn, json.RawMessage, error) {
+	header, err := s.headers(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := dialWebsocket(ctx, s.url, wsProtocol, header, s.tls)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	first, err := s.init(ctx, conn, header, query, vars)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, first, nil
+}
+
+// init performs the graphql-ws handshake and starts the subscription. It
+// returns the first result.
+func (s *Subscriber) init(ctx context.Context, conn *wsConn, header http.Header, query string, vars map[string]interface{}) (json.RawMessage, error) {
+
+	// Reading blocks, so the connection is closed if the context is canceled
+	// before the first result arrives.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.conn.Close()
+		case <-done:
+		}
+	}()
+
+	// Dgraph reads the headers of a subscription from the payload of the
+	// connection_init message.
+	payload := make(map[string]string)
+	for k := range header {
+		payload[k] = header.Get(k)
+	}
+	if err := s.write(conn, wsMessage{Type: "connection_init", Payload: payload}); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.read(conn)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != "connection_ack" {
+		return nil, msg.err()
+	}
+
+	start := wsMessage{
+		ID:   subscriptionID,
+		Type: "start",
+		Payload: map[string]interface{}{
+			"query":     query,
+			"variables": vars,
+		},
+	}
+	if err := s.write(conn, start); err != nil {
+		return nil, err
+	}
+
+	msg, err = s.read(conn)
+	if err != nil {
+		return nil, err
+	}
+	return msg.data()
+}
+
+// receive sends the first result and every result pushed after it to the
+// channel. It returns when the connection fails, a result carries errors or
+// the context is canceled.
+func (s *Subscriber) receive(ctx context.Context, conn *wsConn, first json.RawMessage, ch chan<- Push) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.write(conn, wsMessage{ID: subscriptionID, Type: "stop"})
+			s.write(conn, wsMessage{Type: "connection_terminate"})
+			conn.conn.Close()
+		case <-done:
+		}
+	}()
+
+	data := first
+	for {
+		select {
+		case ch <- Push{Data: data}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		msg, err := s.read(conn)
+		if err != nil {
+			return err
+		}
+		if data, err = msg.data(); err != nil {
+			return err
+		}
+	}
+}
+
+// headers returns the headers that authenticate a connection.
+func (s *Subscriber) headers(ctx context.Context) (http.Header, error) {
+	header := make(http.Header)
+
+	switch {
+	case s.signer != nil:
+		claims, ok := ClaimsFromContext(ctx)
+		if !ok {
+			claims = s.claims
+		}
+		token, err := s.signer.Sign(claims)
+		if err != nil {
+			return nil, fmt.Errorf("signing subscription: %w", err)
+		}
+		header.Set(s.header, token)
+
+	case s.token != "":
+		header.Set(s.header, s.token)
+	}
+
+	if s.session != nil {
+		token, err := s.session.retrieve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("acl login: %w", err)
+		}
+		header.Set(accessHeader, token)
+	}
+
+	return header, nil
+}
+
+// write encodes and sends the message.
+func (s *Subscriber) write(conn *wsConn, msg wsMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("subscription encoding error: %w", err)
+	}
+	return conn.WriteMessage(data)
+}
+
+// read returns the next message, skipping keep alives. Every message moves
+// the read deadline, so a connection the server stopped serving fails once
+// no keep alive has arrived in time.
+func (s *Subscriber) read(conn *wsConn) (wsMessage, error) {
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.keepAlive))
+
+		data, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return wsMessage{}, fmt.Errorf("no keep alive within %v: %w", s.keepAlive, err)
+			}
+			return wsMessage{}, err
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return wsMessage{}, fmt.Errorf("subscription decoding error: %w message: %s", err, string(data))
+		}
+		if msg.Type != "ka" {
+			return msg, nil
+		}
+	}
+}
+
+// rejected reports if the database refused the subscription for a reason
+// starting it again won't fix, such as an invalid query or a lack of
+// permissions.
+func rejected(err error) bool {
+	var dbErr *Error
+	var notReady *NotReadyError
+	return errors.As(err, &dbErr) && !errors.As(err, &notReady)
+}
+
+// logf writes to the log when one is configured.
+func (s *Subscriber) logf(format string, v ...interface{}) {
+	if s.log != nil {
+		s.log.Printf(format, v...)
+	}
+}
+
+// =============================================================================
+
+// wsMessage represents a message of the graphql-ws protocol.
+type wsMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// data returns the data of a result, or the errors it carries as an *Error.
+func (m wsMessage) data() (json.RawMessage, error) {
+	if m.Type != "data" {
+		return nil, m.err()
+	}
+
+	raw, err := json.Marshal(m.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("subscription decoding error: %w", err)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GQLError      `json:"errors"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("subscription decoding error: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, &Error{Command: "subscription", Status: http.StatusOK, Errors: result.Errors}
+	}
+
+	return result.Data, nil
+}
+
+// err returns the error a message that isn't expected represents.
+func (m wsMessage) err() error {
+	switch m.Type {
+	case "error", "connection_error":
+		raw, _ := json.Marshal(m.Payload)
+
+		var gqlErrs []GQLError
+		if json.Unmarshal(raw, &gqlErrs) != nil {
+			var gqlErr GQLError
+			if json.Unmarshal(raw, &gqlErr) != nil || gqlErr.Message == "" {
+				gqlErr.Message = string(raw)
+			}
+			gqlErrs = []GQLError{gqlErr}
+		}
+		return &Error{Command: "subscription", Status: http.StatusOK, Errors: gqlErrs}
+
+	case "complete":
+		return errors.New("subscription completed by the server")
+	}
+
+	return fmt.Errorf("unexpected subscription message %q", m.Type)
+}
@@ -0,0 +1,393 @@
+package data_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// wsServer mimics the graphql-ws endpoint. Every connection is answered with
+// the next script of results and dropped once the script is done, except the
+// last one which is kept open. When hold is set every connection is kept
+// open without sending anything more.
+type wsServer struct {
+	scripts [][]string
+	hold    bool
+
+	mu       sync.Mutex
+	conns    int
+	payloads []map[string]string
+	starts   []map[string]interface{}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (ws *wsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Sec-WebSocket-Protocol") != "graphql-ws" {
+		http.Error(w, "unsupported protocol", http.StatusBadRequest)
+		return
+	}
+
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\nSec-WebSocket-Protocol: graphql-ws\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	brw.Flush()
+
+	ws.mu.Lock()
+	last := ws.conns >= len(ws.scripts)-1
+	script := ws.scripts[len(ws.scripts)-1]
+	if !last {
+		script = ws.scripts[ws.conns]
+	}
+	ws.conns++
+	ws.mu.Unlock()
+
+	var init struct {
+		Payload map[string]string `json:"payload"`
+	}
+	if err := json.Unmarshal(readFrame(brw.Reader), &init); err != nil {
+		return
+	}
+	writeFrame(conn, `{"type":"connection_ack"}`)
+
+	var start struct {
+		Payload map[string]interface{} `json:"payload"`
+	}
+	if err := json.Unmarshal(readFrame(brw.Reader), &start); err != nil {
+		return
+	}
+
+	ws.mu.Lock()
+	ws.payloads = append(ws.payloads, init.Payload)
+	ws.starts = append(ws.starts, start.Payload)
+	ws.mu.Unlock()
+
+	for _, msg := range script {
+		writeFrame(conn, `{"type":"ka"}`)
+		writeFrame(conn, msg)
+	}
+
+	// Keep the last connection open until the client stops the subscription.
+	if last || ws.hold {
+		readFrame(brw.Reader)
+	}
+}
+
+// readFrame reads the payload of a masked client frame.
+func readFrame(r *bufio.Reader) []byte {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil
+	}
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	io.ReadFull(r, mask[:])
+
+	payload := make([]byte, size)
+	io.ReadFull(r, payload)
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return payload
+}
+
+// writeFrame writes the message as an unmasked text frame.
+func writeFrame(conn net.Conn, msg string) {
+	frame := []byte{0x81}
+	switch n := len(msg); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	default:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	}
+	conn.Write(append(frame, msg...))
+}
+
+// result returns a data message carrying the users.
+func result(users ...string) string {
+	return fmt.Sprintf(`{"id":"1","type":"data","payload":{"data":{"queryUser":[%s]}}}`, strings.Join(users, ","))
+}
+
+// TestSubscribe validates subscriptions deliver the changes pushed by the
+// database and are restarted when the connection is lost.
+func TestSubscribe(t *testing.T) {
+	t.Log("Given the need to be told about changes to users.")
+	{
+		bill := `{"id":"0x1","source":"twitter","source_id":"1","name":"Bill"}`
+		billRenamed := `{"id":"0x1","source":"twitter","source_id":"1","name":"Bill Kennedy"}`
+		jack := `{"id":"0x2","source":"twitter","source_id":"2","name":"Jack"}`
+
+		ws := wsServer{
+			scripts: [][]string{
+				{result(bill), result(billRenamed)},
+				{result(billRenamed, jack)},
+			},
+		}
+		srv := httptest.NewServer(&ws)
+		defer srv.Close()
+
+		signer := data.NewSigner("test-key", "", time.Minute)
+		gqlConfig := data.GraphQLConfig{
+			URL:            srv.URL,
+			AuthHeaderName: "X-Test-Auth",
+			Signer:         signer,
+			Claims:         data.Claims{Role: data.RoleAdmin},
+			Retry:          data.RetryConfig{Backoff: time.Millisecond},
+		}
+
+		gql, err := data.NewGraphQL(gqlConfig)
+		if err != nil {
+			t.Fatalf("\tShould be able to construct the client: %v", err)
+		}
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen watching users across a lost connection.", testID)
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			ch, err := user.Watch(ctx, gql, user.Filter{Source: "twitter"})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to watch the users: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to watch the users.", tests.Success, testID)
+
+			var names []string
+			for i := 0; i < 3; i++ {
+				select {
+				case u := <-ch:
+					names = append(names, u.Name)
+				case <-ctx.Done():
+					t.Fatalf("\t%s\tTest %d:\tShould receive the changes, got %v.", tests.Failed, testID, names)
+				}
+			}
+			exp := []string{"Bill", "Bill Kennedy", "Jack"}
+			for i := range exp {
+				if names[i] != exp[i] {
+					t.Fatalf("\t%s\tTest %d:\tShould receive every change once, exp %v got %v.", tests.Failed, testID, exp, names)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive every change once.", tests.Success, testID)
+
+			ws.mu.Lock()
+			conns := ws.conns
+			payload := ws.payloads[len(ws.payloads)-1]
+			start := ws.starts[len(ws.starts)-1]
+			ws.mu.Unlock()
+
+			if conns != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould reconnect once, got %d connections.", tests.Failed, testID, conns)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reconnect once.", tests.Success, testID)
+
+			if payload["X-Test-Auth"] == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould authenticate the connection: %v", tests.Failed, testID, payload)
+			}
+			t.Logf("\t%s\tTest %d:\tShould authenticate the connection.", tests.Success, testID)
+
+			vars, _ := json.Marshal(start["variables"])
+			if string(vars) != `{"filter":{"source":{"eq":"twitter"}}}` {
+				t.Fatalf("\t%s\tTest %d:\tShould resubscribe with the filter, got %s.", tests.Failed, testID, vars)
+			}
+			t.Logf("\t%s\tTest %d:\tShould resubscribe with the filter.", tests.Success, testID)
+
+			cancel()
+			select {
+			case _, open := <-ch:
+				if open {
+					t.Fatalf("\t%s\tTest %d:\tShould not receive more users.", tests.Failed, testID)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould close the channel when canceled.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close the channel when canceled.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the subscription is rejected.", testID)
+		{
+			ws := wsServer{
+				scripts: [][]string{
+					{`{"id":"1","type":"error","payload":[{"message":"Cannot query field \"nope\" on type \"User\"."}]}`},
+				},
+			}
+			srv := httptest.NewServer(&ws)
+			defer srv.Close()
+
+			sub, err := data.NewSubscriber(data.GraphQLConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the subscriber: %v", tests.Failed, testID, err)
+			}
+
+			_, err = sub.Subscribe(context.Background(), `subscription { queryUser { nope } }`, nil)
+			var invalid *data.ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("\t%s\tTest %d:\tShould return a validation error: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return a validation error.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen the connection goes quiet.", testID)
+		{
+			ws := wsServer{
+				scripts: [][]string{
+					{result(bill)},
+					{result(billRenamed)},
+				},
+				hold: true,
+			}
+			srv := httptest.NewServer(&ws)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, KeepAlive: 100 * time.Millisecond, Retry: data.RetryConfig{Backoff: time.Millisecond}})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			ch, err := user.Watch(ctx, gql, user.Filter{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to watch the users: %v", tests.Failed, testID, err)
+			}
+
+			var names []string
+			for i := 0; i < 2; i++ {
+				select {
+				case u := <-ch:
+					names = append(names, u.Name)
+				case <-ctx.Done():
+					t.Fatalf("\t%s\tTest %d:\tShould reconnect once no keep alive arrives, got %v.", tests.Failed, testID, names)
+				}
+			}
+			if names[1] != "Bill Kennedy" {
+				t.Fatalf("\t%s\tTest %d:\tShould reconnect once no keep alive arrives, got %v.", tests.Failed, testID, names)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reconnect once no keep alive arrives.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen users leave the results and a bad result is pushed.", testID)
+		{
+			ws := wsServer{
+				scripts: [][]string{
+					{result(bill, jack), result(bill), result(bill, jack), `{"id":"1","type":"data","payload":{"data":{"queryUser":"nope"}}}`},
+				},
+			}
+			srv := httptest.NewServer(&ws)
+			defer srv.Close()
+
+			gql, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			ch, err := user.Watch(ctx, gql, user.Filter{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to watch the users: %v", tests.Failed, testID, err)
+			}
+
+			var names []string
+			for u := range ch {
+				names = append(names, u.Name)
+			}
+			if ctx.Err() != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould stop at the result that can't be decoded, got %v.", tests.Failed, testID, names)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop at the result that can't be decoded.", tests.Success, testID)
+
+			exp := []string{"Bill", "Jack", "Jack"}
+			if strings.Join(names, ",") != strings.Join(exp, ",") {
+				t.Fatalf("\t%s\tTest %d:\tShould send a user again once it returns, exp %v got %v.", tests.Failed, testID, exp, names)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send a user again once it returns.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen a result carries errors.", testID)
+		{
+			ws := wsServer{
+				scripts: [][]string{
+					{result(bill), `{"id":"1","type":"data","payload":{"errors":[{"message":"Server not ready"}]}}`},
+					{result(billRenamed), `{"id":"1","type":"data","payload":{"errors":[{"message":"unauthorized to query User","extensions":{"code":"ErrorUnauthorized"}}]}}`},
+				},
+			}
+			srv := httptest.NewServer(&ws)
+			defer srv.Close()
+
+			sub, err := data.NewSubscriber(data.GraphQLConfig{URL: srv.URL, Retry: data.RetryConfig{Backoff: time.Millisecond}})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the subscriber: %v", tests.Failed, testID, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			ch, err := sub.Subscribe(ctx, `subscription { queryUser { name } }`, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to subscribe: %v", tests.Failed, testID, err)
+			}
+
+			var pushes []data.Push
+			for push := range ch {
+				pushes = append(pushes, push)
+			}
+			if ctx.Err() != nil || len(pushes) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould stop once the subscription is rejected, got %d pushes.", tests.Failed, testID, len(pushes))
+			}
+
+			var authErr *data.AuthError
+			if pushes[0].Err != nil || pushes[1].Err != nil || !errors.As(pushes[2].Err, &authErr) {
+				t.Fatalf("\t%s\tTest %d:\tShould send why the subscription was rejected: %v", tests.Failed, testID, pushes[2].Err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send why the subscription was rejected.", tests.Success, testID)
+
+			ws.mu.Lock()
+			conns := ws.conns
+			ws.mu.Unlock()
+
+			if conns != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould reconnect only while the database isn't ready, got %d connections.", tests.Failed, testID, conns)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reconnect only while the database isn't ready.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package data_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestTLS validates the client can connect to a cluster that requires
+// mutual TLS.
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The server certificate is only valid for the dgraph.local name, so
+	// the server name has to be configured to verify it.
+	ca := newCA(t)
+	serverCert := ca.issue(t, "dgraph.local", x509.ExtKeyUsageServerAuth)
+	clientCert := ca.issue(t, "admin", x509.ExtKeyUsageClientAuth)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	writePEM(t, caFile, "CERTIFICATE", ca.cert.Raw)
+	certFile, keyFile := clientCert.write(t, dir, "client")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tls()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	t.Log("Given the need to talk to a cluster that requires client certificates.")
+	{
+		table := []struct {
+			name    string
+			tls     data.TLSConfig
+			success bool
+		}{
+			{"mtls", data.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "dgraph.local"}, true},
+			{"nocert", data.TLSConfig{CAFile: caFile, ServerName: "dgraph.local"}, false},
+			{"noca", data.TLSConfig{CertFile: certFile, KeyFile: keyFile, ServerName: "dgraph.local"}, false},
+			{"noservername", data.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, false},
+			{"insecure", data.TLSConfig{CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true}, true},
+		}
+
+		for testID, tt := range table {
+			tf := func(t *testing.T) {
+				t.Logf("\tTest %d:\tWhen connecting with the %s configuration.", testID, tt.name)
+				{
+					gqlConfig := data.GraphQLConfig{
+						URL:   srv.URL,
+						Retry: data.RetryConfig{Attempts: -1},
+						TLS:   tt.tls,
+					}
+					gql, err := data.NewGraphQL(gqlConfig)
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+					}
+
+					err = gql.Query(context.Background(), `query { queryUser { id } }`, nil)
+					switch {
+					case tt.success && err != nil:
+						t.Fatalf("\t%s\tTest %d:\tShould be able to query the server: %v", tests.Failed, testID, err)
+					case !tt.success && err == nil:
+						t.Fatalf("\t%s\tTest %d:\tShould be rejected by the handshake.", tests.Failed, testID)
+					}
+					t.Logf("\t%s\tTest %d:\tShould get the expected result from the handshake.", tests.Success, testID)
+				}
+			}
+			t.Run(tt.name, tf)
+		}
+
+		testID := len(table)
+		t.Logf("\tTest %d:\tWhen the client key is missing.", testID)
+		{
+			_, err := data.NewGraphQL(data.GraphQLConfig{URL: srv.URL, TLS: data.TLSConfig{CertFile: certFile}})
+			if err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail to construct the client.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail to construct the client.", tests.Success, testID)
+		}
+	}
+}
+
+// =============================================================================
+
+// keyPair represents a certificate and its private key.
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newCA constructs a self signed certificate authority.
+func newCA(t *testing.T) keyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating ca key: %v", err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating ca: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing ca: %v", err)
+	}
+
+	return keyPair{cert: cert, key: key}
+}
+
+// issue constructs a certificate for the specified name signed by the ca.
+func (ca keyPair) issue(t *testing.T, name string, usage x509.ExtKeyUsage) keyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+
+	return keyPair{cert: cert, key: key}
+}
+
+// tls returns the key pair for use by a tls server.
+func (kp keyPair) tls() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{kp.cert.Raw},
+		PrivateKey:  kp.key,
+	}
+}
+
+// write stores the key pair as PEM files in the directory.
+func (kp keyPair) write(t *testing.T, dir string, name string) (string, string) {
+	der, err := x509.MarshalECPrivateKey(kp.key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", kp.cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", der)
+
+	return certFile, keyFile
+}
+
+// writePEM writes the block to the named file.
+func writePEM(t *testing.T, name string, kind string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+}
@@ -0,0 +1,396 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTxnFinished is returned when a transaction is used after it was
+// committed or discarded.
+var ErrTxnFinished = errors.New("transaction already committed or discarded")
+
+// DQL provides support for running DQL queries and mutations inside
+// transactions against the /query, /mutate and /commit endpoints.
+type DQL struct {
+	url        string
+	client     *http.Client
+	header     string
+	token      string
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// NewDQL constructs a DQL value for use to run transactions against the
+// database. Requests are made with the same settings as NewGraphQL. A
+// transaction that is aborted because of a conflict is retried according to
+// the retry policy in the configuration.
+func NewDQL(gqlConfig GraphQLConfig) (*DQL, error) {
+	client, err := newClient(gqlConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := gqlConfig.Retry.Attempts
+	switch {
+	case retries == 0:
+		retries = 8
+	case retries < 0:
+		retries = 0
+	}
+
+	backoff := gqlConfig.Retry.Backoff
+	if backoff <= 0 {
+		backoff = 250 * time.Millisecond
+	}
+
+	maxBackoff := gqlConfig.Retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 4 * time.Second
+	}
+
+	dql := DQL{
+		url:        strings.TrimRight(gqlConfig.URL, "/") + "/",
+		client:     client,
+		header:     gqlConfig.AuthHeaderName,
+		token:      gqlConfig.AuthToken,
+		retries:    retries,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+	}
+	return &dql, nil
+}
+
+// NewTxn starts a new transaction. It must be committed or discarded.
+func (d *DQL) NewTxn() *Txn {
+	return &Txn{dql: d}
+}
+
+// Run executes the function inside a new transaction and commits it. If the
+// function returns an error the transaction is discarded. If the transaction
+// is aborted because of a conflict with another one, the function is run
+// again in a new transaction after waiting as long as the retry policy says,
+// so it must not have side effects outside of the transaction.
+func (d *DQL) Run(ctx context.Context, fn func(ctx context.Context, txn *Txn) error) error {
+	wait := d.backoff
+
+	for attempt := 0; ; attempt++ {
+		txn := d.NewTxn()
+
+		err := fn(ctx, txn)
+		if err == nil {
+			err = txn.Commit(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		txn.Discard(ctx)
+
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) || attempt == d.retries {
+			return err
+		}
+		metrics.Add("aborts", 1)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if wait *= 2; wait > d.maxBackoff {
+			wait = d.maxBackoff
+		}
+	}
+}
+
+// =============================================================================
+
+// Mutation represents a set of changes to apply. Changes are provided either
+// as JSON values or as N-Quads, but not both. Cond is an @if condition that
+// decides if the mutation is applied when it is part of an upsert block.
+type Mutation struct {
+	Set       interface{}
+	Delete    interface{}
+	SetNQuads string
+	DelNQuads string
+	Cond      string
+}
+
+// nquads reports if the changes are provided as N-Quads.
+func (m Mutation) nquads() bool {
+	return m.SetNQuads != "" || m.DelNQuads != ""
+}
+
+// Txn represents a transaction. It isn't safe for concurrent use.
+type Txn struct {
+	dql      *DQL
+	startTs  uint64
+	keys     []string
+	preds    []string
+	mutated  bool
+	finished bool
+}
+
+// Query runs a query inside the transaction and decodes the results into
+// the response.
+func (t *Txn) Query(ctx context.Context, query string, vars map[string]interface{}, response interface{}) error {
+	if t.finished {
+		return ErrTxnFinished
+	}
+
+	request := struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{
+		Query:     query,
+		Variables: vars,
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("dql encoding error: %w", err)
+	}
+
+	return t.do(ctx, "query", nil, "application/json", body, response)
+}
+
+// Mutate applies the mutations inside the transaction. It returns the uids
+// assigned to the blank nodes in the mutations.
+func (t *Txn) Mutate(ctx context.Context, mutations ...Mutation) (map[string]string, error) {
+	var result struct {
+		Uids map[string]string `json:"uids"`
+	}
+	if err := t.mutate(ctx, "", mutations, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Uids, nil
+}
+
+// Commit makes the changes of the transaction visible to everyone. It
+// returns a ConflictError if the transaction conflicted with another one.
+func (t *Txn) Commit(ctx context.Context) error {
+	if t.finished {
+		return ErrTxnFinished
+	}
+	t.finished = true
+
+	if !t.mutated {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string][]string{"keys": t.keys, "preds": t.preds})
+	if err != nil {
+		return fmt.Errorf("dql encoding error: %w", err)
+	}
+
+	return t.do(ctx, "commit", nil, "application/json", body, nil)
+}
+
+// Discard throws away the changes of the transaction. It is safe to call
+// Discard after Commit, so it can be deferred.
+func (t *Txn) Discard(ctx context.Context) error {
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
+	if !t.mutated {
+		return nil
+	}
+
+	params := url.Values{"abort": {"true"}}
+	return t.do(ctx, "commit", params, "application/json", nil, nil)
+}
+
+// mutate applies the mutations, conditionally on the results of the query
+// when one is provided, and decodes the results into the response.
+func (t *Txn) mutate(ctx context.Context, query string, mutations []Mutation, response interface{}) error {
+	if t.finished {
+		return ErrTxnFinished
+	}
+	if len(mutations) == 0 {
+		return errors.New("no mutations provided")
+	}
+
+	contentType, body, err := encodeMutations(query, mutations)
+	if err != nil {
+		return err
+	}
+
+	if err := t.do(ctx, "mutate", nil, contentType, body, response); err != nil {
+		return err
+	}
+	t.mutated = true
+
+	return nil
+}
+
+// do performs a request inside the transaction and keeps track of the
+// transaction state the database reports back.
+func (t *Txn) do(ctx context.Context, command string, params url.Values, contentType string, body []byte, response interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	if t.startTs != 0 {
+		params.Set("startTs", strconv.FormatUint(t.startTs, 10))
+	}
+
+	endpoint := t.dql.url + command
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("dql create request error: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if t.dql.token != "" {
+		req.Header.Set(t.dql.header, t.dql.token)
+	}
+
+	resp, err := t.dql.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("dql request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("dql copy error: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dql op error: status code: %s", resp.Status)
+	}
+
+	result := struct {
+		Data       interface{} `json:"data"`
+		Extensions struct {
+			Txn struct {
+				StartTs uint64   `json:"start_ts"`
+				Keys    []string `json:"keys"`
+				Preds   []string `json:"preds"`
+			} `json:"txn"`
+		} `json:"extensions"`
+	}{
+		Data: response,
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("dql decoding error: %w response: %s", err, string(data))
+	}
+
+	txn := result.Extensions.Txn
+	if t.startTs == 0 {
+		t.startTs = txn.StartTs
+	}
+	t.keys = merge(t.keys, txn.Keys)
+	t.preds = merge(t.preds, txn.Preds)
+
+	return nil
+}
+
+// encodeMutations constructs the body of a mutate request. Mutations in
+// N-Quads are sent as an RDF upsert block, JSON mutations as a JSON request.
+func encodeMutations(query string, mutations []Mutation) (string, []byte, error) {
+	nquads := mutations[0].nquads()
+	for _, m := range mutations {
+		if m.nquads() != nquads || (nquads && (m.Set != nil || m.Delete != nil)) {
+			return "", nil, errors.New("mutations must all be json or all be n-quads")
+		}
+	}
+
+	if nquads {
+		var b strings.Builder
+
+		// Without a query there is nothing to condition on, so the changes
+		// are sent as a single set of N-Quads.
+		if query == "" {
+			var set, del []string
+			for _, m := range mutations {
+				if m.SetNQuads != "" {
+					set = append(set, m.SetNQuads)
+				}
+				if m.DelNQuads != "" {
+					del = append(del, m.DelNQuads)
+				}
+			}
+			b.WriteString("{\n")
+			if len(set) > 0 {
+				fmt.Fprintf(&b, "set {\n%s\n}\n", strings.Join(set, "\n"))
+			}
+			if len(del) > 0 {
+				fmt.Fprintf(&b, "delete {\n%s\n}\n", strings.Join(del, "\n"))
+			}
+			b.WriteString("}")
+			return "application/rdf", []byte(b.String()), nil
+		}
+
+		fmt.Fprintf(&b, "upsert {\nquery %s\n", query)
+		for _, m := range mutations {
+			fmt.Fprintf(&b, "mutation %s {\n", m.Cond)
+			if m.SetNQuads != "" {
+				fmt.Fprintf(&b, "set {\n%s\n}\n", m.SetNQuads)
+			}
+			if m.DelNQuads != "" {
+				fmt.Fprintf(&b, "delete {\n%s\n}\n", m.DelNQuads)
+			}
+			b.WriteString("}\n")
+		}
+		b.WriteString("}")
+		return "application/rdf", []byte(b.String()), nil
+	}
+
+	type mutation struct {
+		Set    interface{} `json:"set,omitempty"`
+		Delete interface{} `json:"delete,omitempty"`
+		Cond   string      `json:"cond,omitempty"`
+	}
+	request := struct {
+		Query     string     `json:"query,omitempty"`
+		Mutations []mutation `json:"mutations"`
+	}{
+		Query: query,
+	}
+	for _, m := range mutations {
+		request.Mutations = append(request.Mutations, mutation{Set: m.Set, Delete: m.Delete, Cond: m.Cond})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", nil, fmt.Errorf("dql encoding error: %w", err)
+	}
+	return "application/json", body, nil
+}
+
+// merge appends the values that aren't in the list yet.
+func merge(list []string, values []string) []string {
+	for _, v := range values {
+		var found bool
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,152 @@
+package data_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// txnServer mimics the transaction endpoints. Every transaction gets its
+// own start timestamp and the first abortFirst commits are aborted.
+type txnServer struct {
+	abortFirst int
+
+	mu      sync.Mutex
+	next    uint64
+	commits []string
+	aborts  int
+	paths   []string
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (ts *txnServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	ts.paths = append(ts.paths, r.URL.String())
+
+	startTs := r.URL.Query().Get("startTs")
+	if startTs == "" {
+		ts.next++
+		startTs = fmt.Sprint(ts.next)
+	}
+
+	switch r.URL.Path {
+	case "/query":
+		fmt.Fprintf(w, `{"data":{"q":[{"uid":"0x1","count":1}]},"extensions":{"txn":{"start_ts":%s}}}`, startTs)
+
+	case "/mutate":
+		fmt.Fprintf(w, `{"data":{"code":"Success","uids":{"u":"0x2"}},"extensions":{"txn":{"start_ts":%s,"keys":["k%s"],"preds":["1-count"]}}}`, startTs, startTs)
+
+	case "/commit":
+		if r.URL.Query().Get("abort") == "true" {
+			w.Write([]byte(`{"data":{"code":"Success","message":"Done"}}`))
+			return
+		}
+		if ts.aborts < ts.abortFirst {
+			ts.aborts++
+			w.Write([]byte(`{"errors":[{"message":"Transaction has been aborted. Please retry","extensions":{"code":"Error"}}]}`))
+			return
+		}
+		ts.commits = append(ts.commits, string(body))
+		w.Write([]byte(`{"data":{"code":"Success","message":"Done"}}`))
+	}
+}
+
+// TestTxn validates transactions carry their state between requests and are
+// retried when aborted.
+func TestTxn(t *testing.T) {
+	t.Log("Given the need to run read-modify-write transactions.")
+	{
+		ts := txnServer{abortFirst: 1}
+		srv := httptest.NewServer(&ts)
+		defer srv.Close()
+
+		dql, err := data.NewDQL(data.GraphQLConfig{URL: srv.URL, Retry: data.RetryConfig{Attempts: 3, Backoff: time.Millisecond}})
+		if err != nil {
+			t.Fatalf("\tShould be able to construct the client: %v", err)
+		}
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a transaction is aborted on commit.", testID)
+		{
+			var runs int
+			err := dql.Run(context.Background(), func(ctx context.Context, txn *data.Txn) error {
+				runs++
+
+				var result struct {
+					Q []struct {
+						UID   string `json:"uid"`
+						Count int    `json:"count"`
+					} `json:"q"`
+				}
+				if err := txn.Query(ctx, `{ q(func: uid(0x1)) { uid count } }`, nil, &result); err != nil {
+					return err
+				}
+
+				mu := data.Mutation{Set: map[string]interface{}{"uid": result.Q[0].UID, "count": result.Q[0].Count + 1}}
+				uids, err := txn.Mutate(ctx, mu)
+				if err != nil {
+					return err
+				}
+				if uids["u"] != "0x2" {
+					return fmt.Errorf("unexpected uids %v", uids)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to commit the transaction: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to commit the transaction.", tests.Success, testID)
+
+			if runs != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould run the transaction again once, got %d runs.", tests.Failed, testID, runs)
+			}
+			t.Logf("\t%s\tTest %d:\tShould run the transaction again once.", tests.Success, testID)
+
+			var commit struct {
+				Keys  []string `json:"keys"`
+				Preds []string `json:"preds"`
+			}
+			if len(ts.commits) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould commit once, got %d.", tests.Failed, testID, len(ts.commits))
+			}
+			json.Unmarshal([]byte(ts.commits[0]), &commit)
+			if len(commit.Keys) != 1 || commit.Keys[0] != "k2" {
+				t.Fatalf("\t%s\tTest %d:\tShould commit the keys of the second transaction: %v", tests.Failed, testID, commit.Keys)
+			}
+			t.Logf("\t%s\tTest %d:\tShould commit the keys of the second transaction.", tests.Success, testID)
+
+			exp := []string{"/query", "/mutate?startTs=1", "/commit?startTs=1", "/query", "/mutate?startTs=2", "/commit?startTs=2"}
+			for i := range exp {
+				if i >= len(ts.paths) || ts.paths[i] != exp[i] {
+					t.Fatalf("\t%s\tTest %d:\tShould carry the start timestamp, exp %v got %v.", tests.Failed, testID, exp, ts.paths)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould carry the start timestamp.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a transaction is used after commit.", testID)
+		{
+			txn := dql.NewTxn()
+			if err := txn.Commit(context.Background()); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to commit an empty transaction: %v", tests.Failed, testID, err)
+			}
+			if _, err := txn.Mutate(context.Background(), data.Mutation{SetNQuads: `_:u <name> "x" .`}); err != data.ErrTxnFinished {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to mutate: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to use the transaction.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/graphql"
+)
+
+// Upsert builds an upsert block: a query that binds variables to the nodes
+// it finds, followed by mutations that are only applied when a condition on
+// those variables holds. Dgraph evaluates the block inside one transaction,
+// so when the queried predicate is indexed with @upsert two blocks racing to
+// create the same node conflict and only one of them commits.
+type Upsert struct {
+	blocks    []string
+	mutations []Mutation
+}
+
+// NewUpsert constructs an empty upsert block.
+func NewUpsert() *Upsert {
+	return &Upsert{}
+}
+
+// Var adds a query block that binds the nodes matching the function and
+// filters to the named variable. The uids of the nodes are also returned in
+// the result under the same name.
+func (u *Upsert) Var(name string, fn string, filters ...string) *Upsert {
+	block := fmt.Sprintf("%s(func: %s)", name, fn)
+	if len(filters) > 0 {
+		block += fmt.Sprintf(" @filter(%s)", strings.Join(filters, " AND "))
+	}
+	block += fmt.Sprintf(" {\n\t\t%s as uid\n\t}", name)
+
+	u.blocks = append(u.blocks, block)
+	return u
+}
+
+// Mutate adds a mutation that is only applied when the condition holds. An
+// empty condition always applies the mutation.
+func (u *Upsert) Mutate(cond string, mu Mutation) *Upsert {
+	mu.Cond = ""
+	if cond != "" {
+		mu.Cond = fmt.Sprintf("@if(%s)", cond)
+	}
+
+	u.mutations = append(u.mutations, mu)
+	return u
+}
+
+// Exec runs the upsert block in a transaction of its own that is committed
+// immediately. The graphql client only sends JSON, so mutations provided as
+// N-Quads must be run with Txn.Upsert instead.
+func (u *Upsert) Exec(ctx context.Context, gql *graphql.GraphQL) (UpsertResult, error) {
+	if len(u.mutations) == 0 {
+		return UpsertResult{}, errors.New("no mutations provided")
+	}
+	for _, mu := range u.mutations {
+		if mu.nquads() {
+			return UpsertResult{}, errors.New("n-quad mutations must be run in a transaction")
+		}
+	}
+
+	_, body, err := encodeMutations(u.query(), u.mutations)
+	if err != nil {
+		return UpsertResult{}, err
+	}
+
+	var result upsertResult
+	if err := gql.Do(ctx, "mutate?commitNow=true", bytes.NewReader(body), &result); err != nil {
+		return UpsertResult{}, fmt.Errorf("upsert: %w", err)
+	}
+
+	return result.convert(), nil
+}
+
+// query returns the query part of the block.
+func (u *Upsert) query() string {
+	if len(u.blocks) == 0 {
+		return ""
+	}
+	return "{\n\t" + strings.Join(u.blocks, "\n\t") + "\n}"
+}
+
+// Upsert runs the upsert block inside the transaction.
+func (t *Txn) Upsert(ctx context.Context, u *Upsert) (UpsertResult, error) {
+	var result upsertResult
+	if err := t.mutate(ctx, u.query(), u.mutations, &result); err != nil {
+		return UpsertResult{}, err
+	}
+
+	return result.convert(), nil
+}
+
+// =============================================================================
+
+// UpsertResult represents the outcome of an upsert block. Uids holds the
+// uids assigned to blank nodes and Queries the uids bound to each variable
+// before the mutations were applied.
+type UpsertResult struct {
+	Uids    map[string]string
+	Queries map[string][]string
+}
+
+// upsertResult represents the response the database returns for an upsert.
+type upsertResult struct {
+	Uids    map[string]string `json:"uids"`
+	Queries map[string][]struct {
+		UID string `json:"uid"`
+	} `json:"queries"`
+}
+
+// convert flattens the response into the result returned to the caller.
+func (ur upsertResult) convert() UpsertResult {
+	result := UpsertResult{
+		Uids:    ur.Uids,
+		Queries: make(map[string][]string),
+	}
+	for name, nodes := range ur.Queries {
+		for _, n := range nodes {
+			result.Queries[name] = append(result.Queries[name], n.UID)
+		}
+	}
+	return result
+}
+
+// =============================================================================
+
+// Eq returns a function that matches nodes where the predicate has the value.
+func Eq(pred string, value string) string {
+	return fmt.Sprintf("eq(%s, %s)", pred, strconv.Quote(value))
+}
+
+// Type returns a function that matches nodes of the type.
+func Type(name string) string {
+	return fmt.Sprintf("type(%s)", name)
+}
+
+// Missing returns a condition that holds when the variable bound no nodes.
+func Missing(name string) string {
+	return fmt.Sprintf("eq(len(%s), 0)", name)
+}
+
+// Exists returns a condition that holds when the variable bound a node.
+func Exists(name string) string {
+	return fmt.Sprintf("gt(len(%s), 0)", name)
+}
+
+// UID returns a reference to the nodes bound to the variable, for use as the
+// uid of a JSON mutation or the subject of an N-Quad.
+func UID(name string) string {
+	return fmt.Sprintf("uid(%s)", name)
+}
@@ -0,0 +1,179 @@
+package data_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/data"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/ardanlabs/graphql"
+)
+
+// upsertServer mimics the mutate endpoint for upserts that create a node
+// only when the key isn't taken. Requests are handled one at a time like
+// Dgraph does for conflicting transactions.
+type upsertServer struct {
+	mu     sync.Mutex
+	nodes  map[string]string
+	bodies []string
+	types  []string
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (us *upsertServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	us.bodies = append(us.bodies, string(body))
+	us.types = append(us.types, r.Header.Get("Content-Type"))
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		fmt.Fprintf(w, `{"data":{"code":"Success","queries":{"user":[{"uid":"0x1"}]}},"extensions":{"txn":{"start_ts":1}}}`)
+		return
+	}
+
+	var req struct {
+		Query     string `json:"query"`
+		Mutations []struct {
+			Set  map[string]interface{} `json:"set"`
+			Cond string                 `json:"cond"`
+		} `json:"mutations"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Mutations) != 1 {
+		w.Write([]byte(`{"errors":[{"message":"bad request"}]}`))
+		return
+	}
+
+	key := fmt.Sprint(req.Mutations[0].Set["key"])
+	if uid, exists := us.nodes[key]; exists {
+		fmt.Fprintf(w, `{"data":{"code":"Success","queries":{"user":[{"uid":%q}]},"uids":{}}}`, uid)
+		return
+	}
+
+	uid := fmt.Sprintf("0x%x", len(us.nodes)+1)
+	us.nodes[key] = uid
+	fmt.Fprintf(w, `{"data":{"code":"Success","queries":{"user":[]},"uids":{"user":%q}}}`, uid)
+}
+
+// TestUpsert validates upsert blocks are encoded for the database and their
+// results are returned.
+func TestUpsert(t *testing.T) {
+	t.Log("Given the need to create nodes only when they don't exist.")
+	{
+		us := upsertServer{nodes: make(map[string]string)}
+		srv := httptest.NewServer(&us)
+		defer srv.Close()
+
+		upsert := func(key string) *data.Upsert {
+			return data.NewUpsert().
+				Var("user", data.Eq("User.key", key)).
+				Mutate(data.Missing("user"), data.Mutation{Set: map[string]interface{}{"uid": "_:user", "key": key}})
+		}
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the same node is upserted in parallel.", testID)
+		{
+			gql := graphql.New(srv.URL, http.DefaultClient)
+
+			const adders = 10
+			results := make([]data.UpsertResult, adders)
+			errs := make([]error, adders)
+
+			var wg sync.WaitGroup
+			for i := 0; i < adders; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], errs[i] = upsert(`twitter:"1"`).Exec(context.Background(), gql)
+				}(i)
+			}
+			wg.Wait()
+
+			var created int
+			for i := range results {
+				if errs[i] != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to run the upsert: %v", tests.Failed, testID, errs[i])
+				}
+				switch {
+				case results[i].Uids["user"] == "0x1":
+					created++
+				case len(results[i].Queries["user"]) != 1 || results[i].Queries["user"][0] != "0x1":
+					t.Fatalf("\t%s\tTest %d:\tShould find the existing node: %+v", tests.Failed, testID, results[i])
+				}
+			}
+			if created != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould create the node exactly once, got %d.", tests.Failed, testID, created)
+			}
+			t.Logf("\t%s\tTest %d:\tShould create the node exactly once.", tests.Success, testID)
+
+			var req struct {
+				Query     string `json:"query"`
+				Mutations []struct {
+					Cond string `json:"cond"`
+				} `json:"mutations"`
+			}
+			json.Unmarshal([]byte(us.bodies[0]), &req)
+			if !strings.Contains(req.Query, `user(func: eq(User.key, "twitter:\"1\""))`) || !strings.Contains(req.Query, "user as uid") {
+				t.Fatalf("\t%s\tTest %d:\tShould bind the variable in the query:\n%s", tests.Failed, testID, req.Query)
+			}
+			if req.Mutations[0].Cond != "@if(eq(len(user), 0))" {
+				t.Fatalf("\t%s\tTest %d:\tShould condition the mutation, got %q.", tests.Failed, testID, req.Mutations[0].Cond)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the query and condition.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen an upsert with N-Quads is run.", testID)
+		{
+			gql := graphql.New(srv.URL, http.DefaultClient)
+
+			nquads := data.NewUpsert().
+				Var("user", data.Eq("User.key", "twitter:1"), data.Type("User")).
+				Mutate(data.Exists("user"), data.Mutation{SetNQuads: data.UID("user") + ` <User.name> "Bill" .`})
+
+			if _, err := nquads.Exec(context.Background(), gql); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to run it without a transaction.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to run it without a transaction.", tests.Success, testID)
+
+			dql, err := data.NewDQL(data.GraphQLConfig{URL: srv.URL, Retry: data.RetryConfig{Attempts: -1}})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the client: %v", tests.Failed, testID, err)
+			}
+
+			txn := dql.NewTxn()
+			result, err := txn.Upsert(context.Background(), nquads)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to run it in a transaction: %v", tests.Failed, testID, err)
+			}
+			if len(result.Queries["user"]) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould return the bound nodes: %+v", tests.Failed, testID, result)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to run it in a transaction.", tests.Success, testID)
+
+			body := us.bodies[len(us.bodies)-1]
+			for _, exp := range []string{
+				"upsert {",
+				`user(func: eq(User.key, "twitter:1")) @filter(type(User))`,
+				"mutation @if(gt(len(user), 0))",
+				`uid(user) <User.name> "Bill" .`,
+			} {
+				if !strings.Contains(body, exp) {
+					t.Fatalf("\t%s\tTest %d:\tShould contain %s:\n%s", tests.Failed, testID, exp, body)
+				}
+			}
+			if ct := us.types[len(us.types)-1]; ct != "application/rdf" {
+				t.Fatalf("\t%s\tTest %d:\tShould send RDF, got %s.", tests.Failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send an RDF upsert block.", tests.Success, testID)
+		}
+	}
+}
@@ -1,40 +1,108 @@
 package user
 
+import "time"
+
 // User represents someone with access to the system.
 type User struct {
-	ID           string `json:"id"`
-	SourceID     string `json:"source_id"`
-	Source       string `json:"source"`
-	ScreenName   string `json:"screen_name"`
-	Name         string `json:"name"`
-	Location     string `json:"location"`
-	FriendsCount int    `json:"friends_count"`
-	Friends      []User `json:"friends"`
+	ID           string    `json:"id"`
+	SourceID     string    `json:"source_id"`
+	Source       string    `json:"source"`
+	ScreenName   string    `json:"screen_name"`
+	Name         string    `json:"name"`
+	Location     string    `json:"location"`
+	FriendsCount int       `json:"friends_count"`
+	LastSynced   time.Time `json:"last_synced"`
+	Friends      []User    `json:"friends"`
+	PastFriends  []User    `json:"past_friends"`
+	Follows      []Follow  `json:"follows"`
+	PageRank     float64   `json:"pagerank"`
+	InDegree     int       `json:"in_degree"`
+	OutDegree    int       `json:"out_degree"`
+	Betweenness  float64   `json:"betweenness"`
+	Community    int       `json:"community"`
+}
+
+// Follow represents the period of time a user followed a friend. A follow
+// that hasn't ended has a zero Until.
+type Follow struct {
+	ID     string    `json:"id"`
+	Friend User      `json:"friend"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
 }
 
 // NewUser contains information needed to create a new User.
 type NewUser struct {
-	SourceID     string `json:"source_id"`
-	Source       string `json:"source"`
-	ScreenName   string `json:"screen_name"`
-	Name         string `json:"name"`
-	Location     string `json:"location"`
-	FriendsCount int    `json:"friends_count"`
-	Friends      []User `json:"friends"`
+	SourceID     string    `json:"source_id"`
+	Source       string    `json:"source"`
+	ScreenName   string    `json:"screen_name"`
+	Name         string    `json:"name"`
+	Location     string    `json:"location"`
+	FriendsCount int       `json:"friends_count"`
+	LastSynced   time.Time `json:"last_synced"`
+	Friends      []User    `json:"friends"`
 }
 
-type addResult struct {
-	AddUser struct {
-		User []struct {
-			ID string `json:"id"`
-		} `json:"user"`
-	} `json:"addUser"`
+// UpdateUser defines what information may be provided to modify an existing
+// User. All fields are optional so clients can send just the fields they
+// want changed.
+type UpdateUser struct {
+	ScreenName   *string    `json:"screen_name"`
+	Name         *string    `json:"name"`
+	Location     *string    `json:"location"`
+	FriendsCount *int       `json:"friends_count"`
+	LastSynced   *time.Time `json:"last_synced"`
+	PageRank     *float64   `json:"pagerank"`
+	InDegree     *int       `json:"in_degree"`
+	OutDegree    *int       `json:"out_degree"`
+	Betweenness  *float64   `json:"betweenness"`
+	Community    *int       `json:"community"`
 }
 
-func (addResult) document() string {
-	return `{
-		user {
-			id
+// Filter selects the users to watch. Empty fields match every user, in
+// which case every user is pushed each time any of them changes.
+type Filter struct {
+	IDs    []string
+	Source string
+}
+
+// document returns the filter as a UserFilter, or nil to match every user.
+func (f Filter) document() map[string]interface{} {
+	var doc map[string]interface{}
+	if len(f.IDs) > 0 {
+		doc = map[string]interface{}{"id": f.IDs}
+	}
+	if f.Source != "" {
+		source := map[string]interface{}{"source": map[string]string{"eq": f.Source}}
+		if doc == nil {
+			doc = source
+		} else {
+			doc["and"] = source
 		}
+	}
+	return doc
+}
+
+type updateResult struct {
+	UpdateUser struct {
+		NumUids int `json:"numUids"`
+	} `json:"updateUser"`
+}
+
+func (updateResult) document() string {
+	return `{
+		numUids
+	}`
+}
+
+type addFollowResult struct {
+	AddFollow struct {
+		NumUids int `json:"numUids"`
+	} `json:"addFollow"`
+}
+
+func (addFollowResult) document() string {
+	return `{
+		numUids
 	}`
 }
@@ -3,8 +3,16 @@ package user
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ardanlabs/dgraph/business/data"
 	"github.com/ardanlabs/graphql"
 	"github.com/pkg/errors"
 )
@@ -14,11 +22,18 @@ var (
 	ErrNotExists = errors.New("user does not exist")
 	ErrExists    = errors.New("user exists")
 	ErrNotFound  = errors.New("user not found")
+	ErrInvalidID = errors.New("invalid user id")
 )
 
+// uidPattern matches the ids the database assigns to users. Ids that end up
+// in a DQL query must match it, since they can't be passed as variables.
+var uidPattern = regexp.MustCompile(`^0x[0-9a-f]+$`)
+
 // Add adds a new user to the database. If the user already exists
 // this function will fail but the found user is returned. If the user is
-// being added, the user with the id from the database is returned.
+// being added, the user with the id from the database is returned. The user
+// is created with an upsert on its key, so concurrent adds of the same user
+// result in a single user.
 func Add(ctx context.Context, gql *graphql.GraphQL, nu NewUser) (User, error) {
 	u := User{
 		SourceID:     nu.SourceID,
@@ -27,61 +42,131 @@ func Add(ctx context.Context, gql *graphql.GraphQL, nu NewUser) (User, error) {
 		Name:         nu.Name,
 		Location:     nu.Location,
 		FriendsCount: nu.FriendsCount,
+		LastSynced:   nu.LastSynced.UTC().Truncate(time.Second),
 		Friends:      nu.Friends,
 	}
 
-	u, err := add(ctx, gql, u)
+	upsert := data.NewUpsert().
+		Var("user", data.Eq("User.key", Key(u.Source, u.SourceID))).
+		Mutate(data.Missing("user"), data.Mutation{Set: prepareAdd(u)})
+
+	result, err := upsert.Exec(ctx, gql)
 	if err != nil {
 		return User{}, errors.Wrap(err, "adding user to database")
 	}
 
+	if ids := result.Queries["user"]; len(ids) > 0 {
+		u, err := One(ctx, gql, ids[0])
+		if err != nil {
+			return User{}, errors.Wrap(err, "checking for existing user")
+		}
+		return u, ErrExists
+	}
+
+	u.ID = result.Uids["user"]
+	if u.ID == "" {
+		return User{}, errors.New("user id not returned")
+	}
+
 	return u, nil
 }
 
 // AddFriend adds a new user to the database if the user doesn't already exist.
-// Then the user is added to the collection of friends for the specified user id.
-func AddFriend(ctx context.Context, gql *graphql.GraphQL, userID string, nu NewUser) (User, error) {
-	// Validate the user doesn't already exists by screen name.
-	// Validate the user isn't already in the list of friends for userID.
-	/*
-		mutation {
-			updateUser(input: {
-				filter: {
-					id: ["0x04"]
-				},
-				set: {
-					friends: [{
-						id: "0x06"
-					}]
-				}
-			})
-			{
-				numUids
-			}
+// Then the user is added to the collection of friends for the specified user id
+// and removed from the user's past friends if it was followed before.
+// The follow is recorded as starting at the specified time unless the user
+// is already following the friend. The friend and the follow are added in a
+// single upsert, so concurrent adds of the same friend conflict on the
+// friend edge and only one of them starts a follow. ErrInvalidID is returned
+// when the user id isn't a uid assigned by the database.
+func AddFriend(ctx context.Context, gql *graphql.GraphQL, userID string, nu NewUser, since time.Time) (User, error) {
+	if !uidPattern.MatchString(userID) {
+		return User{}, ErrInvalidID
+	}
+
+	friend, err := Add(ctx, gql, nu)
+	if err != nil && err != ErrExists {
+		return User{}, errors.Wrap(err, "adding friend to database")
+	}
+
+	upsert := data.NewUpsert().
+		Var("user", fmt.Sprintf("uid(%s)", userID), data.Type("User")).
+		Var("open", data.Eq("Follow.key", followKey(userID, friend.ID)), "NOT has(Follow.until)").
+		Mutate(data.Exists("user"), prepareAddFriend(friend.ID)).
+		Mutate(data.Exists("user")+" AND "+data.Missing("open"), prepareOpenFollow(userID, friend.ID, since))
+
+	result, err := upsert.Exec(ctx, gql)
+	if err != nil {
+		return User{}, errors.Wrap(err, "failed to add friend")
+	}
+
+	if len(result.Queries["user"]) == 0 {
+		return User{}, ErrNotExists
+	}
+
+	return friend, nil
+}
+
+// AddPastFriend adds the friend to the collection of past friends for the
+// specified user id without changing the follow history.
+func AddPastFriend(ctx context.Context, gql *graphql.GraphQL, userID string, friendID string) error {
+	var result updateResult
+	mutation := fmt.Sprintf(`
+mutation {
+	updateUser(input: {
+		filter: {
+			id: [%q]
+		},
+		set: {
+			past_friends: [{
+				id: %q
+			}]
 		}
+	})
+	%s
+}`, userID, friendID, result.document())
 
-		mutation {
-		updateUser(input: {
-				filter: {
-					id: ["0x04"]
-				},
-				set: {
-					friends: [{
-						source_id: "4444444444"
-						source: "source"
-						screen_name: "jacksmith"
-						name: "jack smith"
-						location: "Miami, FL"
-					}]
-				}
-			})
-			{
-				numUids
-			}
+	if err := gql.Query(ctx, mutation, &result); err != nil {
+		return errors.Wrap(err, "failed to add past friend")
+	}
+
+	if result.UpdateUser.NumUids != 1 {
+		return ErrNotExists
+	}
+
+	return nil
+}
+
+// RestoreFollow records that the user followed the friend over the specified
+// period. A zero until means the follow hasn't ended. A follow between the
+// same users that started at the same time is only recorded once.
+func RestoreFollow(ctx context.Context, gql *graphql.GraphQL, userID string, friendID string, since time.Time, until time.Time) error {
+	follows, err := followsByKey(ctx, gql, followKey(userID, friendID))
+	if err != nil {
+		return err
+	}
+	for _, f := range follows {
+		if f.Since.Equal(since.UTC().Truncate(time.Second)) {
+			return nil
 		}
-	*/
+	}
 
-	return User{}, nil
+	var result addFollowResult
+	mutation := fmt.Sprintf(`
+mutation {
+	addFollow(input: [%s])
+	%s
+}`, prepareFollow(userID, friendID, since, until), result.document())
+
+	if err := gql.Query(ctx, mutation, &result); err != nil {
+		return errors.Wrap(err, "failed to restore follow")
+	}
+
+	if result.AddFollow.NumUids != 1 {
+		return errors.New("follow not restored")
+	}
+
+	return nil
 }
 
 // One returns the specified user from the database by the city id.
@@ -96,6 +181,7 @@ query {
 		name
 		location
 		friends_count
+		last_synced
 	}
 }`, userID)
 
@@ -125,6 +211,7 @@ query {
 		name
 		location
 		friends_count
+		last_synced
 	}
 }`, screenName)
 
@@ -142,39 +229,853 @@ query {
 	return result.QueryUser[0], nil
 }
 
-// =============================================================================
+// OneBySourceID returns the specified user from the database by the id
+// the user has in the specified source.
+func OneBySourceID(ctx context.Context, gql *graphql.GraphQL, source string, sourceID string) (User, error) {
+	query := fmt.Sprintf(`
+query {
+	queryUser(filter: { source_id: { eq: %q }, and: { source: { eq: %q } } }) {
+		id
+		source_id
+    	source
+		screen_name
+		name
+		location
+		friends_count
+		last_synced
+	}
+}`, sourceID, source)
 
-func add(ctx context.Context, gql *graphql.GraphQL, user User) (User, error) {
-	mutation, result := prepareAdd(user)
-	if err := gql.Query(ctx, mutation, &result); err != nil {
-		return User{}, errors.Wrap(err, "failed to add user")
+	var result struct {
+		QueryUser []User `json:"queryUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return User{}, errors.Wrap(err, "query failed")
 	}
 
-	if len(result.AddUser.User) != 1 {
-		return User{}, errors.New("user id not returned")
+	if len(result.QueryUser) != 1 {
+		return User{}, ErrNotFound
 	}
 
-	user.ID = result.AddUser.User[0].ID
-	return user, nil
+	return result.QueryUser[0], nil
 }
 
-func prepareAdd(user User) (string, addResult) {
-	var result addResult
+// Update modifies the profile of the specified user. Only the fields that
+// are set in uu are changed.
+func Update(ctx context.Context, gql *graphql.GraphQL, userID string, uu UpdateUser) error {
+	set := prepareUpdate(uu)
+	if len(set) == 0 {
+		return nil
+	}
+
+	var result updateResult
 	mutation := fmt.Sprintf(`
 mutation {
-	addUser(input: [{
-		source_id: %q
-    	source: %q
-		screen_name: %q
-		name: %q
-		location: %q
-		friends_count: %d
-	}])
+	updateUser(input: {
+		filter: {
+			id: [%q]
+		},
+		set: {
+			%s
+		}
+	})
 	%s
-}`, user.SourceID, user.Source, user.ScreenName, user.Name,
-		user.Location, user.FriendsCount, result.document())
+}`, userID, strings.Join(set, "\n\t\t\t"), result.document())
+
+	if err := gql.Query(ctx, mutation, &result); err != nil {
+		return errors.Wrap(err, "failed to update user")
+	}
+
+	if result.UpdateUser.NumUids != 1 {
+		return ErrNotExists
+	}
+
+	return nil
+}
+
+// UpdateMany modifies the profiles of the specified users in a single
+// request. The updates are keyed by user id and only the fields that are set
+// in each update are changed.
+func UpdateMany(ctx context.Context, gql *graphql.GraphQL, updates map[string]UpdateUser) error {
+	ids := make([]string, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	var mutations int
+	b.WriteString("mutation {")
+	for i, id := range ids {
+		set := prepareUpdate(updates[id])
+		if len(set) == 0 {
+			continue
+		}
+		mutations++
+		fmt.Fprintf(&b, `
+	u%d: updateUser(input: {
+		filter: {
+			id: [%q]
+		},
+		set: {
+			%s
+		}
+	}) {
+		numUids
+	}`, i, id, strings.Join(set, "\n\t\t\t"))
+	}
+	b.WriteString("\n}")
+
+	if mutations == 0 {
+		return nil
+	}
+
+	var result map[string]struct {
+		NumUids int `json:"numUids"`
+	}
+	if err := gql.Query(ctx, b.String(), &result); err != nil {
+		return errors.Wrap(err, "failed to update users")
+	}
+
+	for i, id := range ids {
+		if r, exists := result[fmt.Sprintf("u%d", i)]; exists && r.NumUids != 1 {
+			return errors.Wrapf(ErrNotExists, "user %s", id)
+		}
+	}
+
+	return nil
+}
 
-	return mutation, result
+// RemoveFriend removes the friend from the collection of friends for the
+// specified user id. The friend is kept in the user's past friends and the
+// follow is recorded as ending at the specified time so the history of who
+// the user followed isn't lost. Both changes are made in a single upsert,
+// so a past friend is never left with an open follow. ErrInvalidID is
+// returned when either id isn't a uid assigned by the database.
+func RemoveFriend(ctx context.Context, gql *graphql.GraphQL, userID string, friendID string, until time.Time) error {
+	if !uidPattern.MatchString(userID) || !uidPattern.MatchString(friendID) {
+		return ErrInvalidID
+	}
+
+	upsert := data.NewUpsert().
+		Var("user", fmt.Sprintf("uid(%s)", userID), data.Type("User")).
+		Var("open", data.Eq("Follow.key", followKey(userID, friendID)), "NOT has(Follow.until)").
+		Mutate(data.Exists("user"), prepareRemoveFriend(friendID)).
+		Mutate(data.Exists("user")+" AND "+data.Exists("open"), prepareEndFollows(until))
+
+	result, err := upsert.Exec(ctx, gql)
+	if err != nil {
+		return errors.Wrap(err, "failed to remove friend")
+	}
+
+	if len(result.Queries["user"]) == 0 {
+		return ErrNotExists
+	}
+
+	return nil
+}
+
+// Friends returns the users the specified user currently follows.
+func Friends(ctx context.Context, gql *graphql.GraphQL, userID string) ([]User, error) {
+	query := fmt.Sprintf(`
+query {
+	getUser(id: %q) {
+		id
+		friends {
+			id
+			source_id
+			source
+			screen_name
+			name
+			location
+			friends_count
+			last_synced
+		}
+	}
+}`, userID)
+
+	var result struct {
+		GetUser User `json:"getUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	if result.GetUser.ID == "" {
+		return nil, ErrNotFound
+	}
+
+	return result.GetUser.Friends, nil
+}
+
+// List returns a page of users ordered by key. The key is unique, so paging
+// through every user never skips or repeats one. Each user includes the
+// identity of the users they currently follow.
+func List(ctx context.Context, gql *graphql.GraphQL, offset int, limit int) ([]User, error) {
+	query := fmt.Sprintf(`
+query {
+	queryUser(order: { asc: key }, first: %d, offset: %d) {
+		id
+		source_id
+		source
+		screen_name
+		name
+		location
+		friends_count
+		last_synced
+		friends {
+			id
+			source_id
+			source
+		}
+	}
+}`, limit, offset)
+
+	var result struct {
+		QueryUser []User `json:"queryUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	return result.QueryUser, nil
+}
+
+// ListHistory returns a page of users ordered by key like List. Each user
+// includes the identity of the users they currently and used to follow and
+// their follow history.
+func ListHistory(ctx context.Context, gql *graphql.GraphQL, offset int, limit int) ([]User, error) {
+	query := fmt.Sprintf(`
+query {
+	queryUser(order: { asc: key }, first: %d, offset: %d) {
+		id
+		source_id
+		source
+		friends {
+			id
+			source_id
+			source
+		}
+		past_friends {
+			id
+			source_id
+			source
+		}
+		follows(order: { asc: since }) {
+			id
+			since
+			until
+			friend {
+				id
+				source_id
+				source
+			}
+		}
+	}
+}`, limit, offset)
+
+	var result struct {
+		QueryUser []User `json:"queryUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	return result.QueryUser, nil
+}
+
+// TopByPageRank returns the users with the highest pagerank along with the
+// rest of their scores.
+func TopByPageRank(ctx context.Context, gql *graphql.GraphQL, limit int) ([]User, error) {
+	query := fmt.Sprintf(`
+query {
+	queryUser(order: { desc: pagerank }, first: %d) {
+		id
+		source_id
+		source
+		screen_name
+		name
+		location
+		friends_count
+		last_synced
+		pagerank
+		in_degree
+		out_degree
+		betweenness
+		community
+	}
+}`, limit)
+
+	var result struct {
+		QueryUser []User `json:"queryUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	return result.QueryUser, nil
+}
+
+// Count returns the number of users and follows stored in the database.
+func Count(ctx context.Context, gql *graphql.GraphQL) (users int, follows int, err error) {
+	query := `
+query {
+	aggregateUser {
+		count
+	}
+	aggregateFollow {
+		count
+	}
+}`
+
+	var result struct {
+		AggregateUser struct {
+			Count int `json:"count"`
+		} `json:"aggregateUser"`
+		AggregateFollow struct {
+			Count int `json:"count"`
+		} `json:"aggregateFollow"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return 0, 0, errors.Wrap(err, "query failed")
+	}
+
+	return result.AggregateUser.Count, result.AggregateFollow.Count, nil
+}
+
+// FriendsAsOf returns the users the specified user was following at the
+// specified time.
+func FriendsAsOf(ctx context.Context, gql *graphql.GraphQL, userID string, at time.Time) ([]User, error) {
+	follows, err := Follows(ctx, gql, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return friendsAt(follows, at), nil
+}
+
+// FriendsDiff returns the users the specified user started and stopped
+// following between the two specified times.
+func FriendsDiff(ctx context.Context, gql *graphql.GraphQL, userID string, from time.Time, to time.Time) (added []User, removed []User, err error) {
+	follows, err := Follows(ctx, gql, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before := friendsAt(follows, from)
+	after := friendsAt(follows, to)
+
+	was := make(map[string]bool, len(before))
+	for _, u := range before {
+		was[u.ID] = true
+	}
+	is := make(map[string]bool, len(after))
+	for _, u := range after {
+		is[u.ID] = true
+	}
+
+	for _, u := range after {
+		if !was[u.ID] {
+			added = append(added, u)
+		}
+	}
+	for _, u := range before {
+		if !is[u.ID] {
+			removed = append(removed, u)
+		}
+	}
+
+	return added, removed, nil
+}
+
+// Follows returns the full follow history of the specified user ordered by
+// the time each follow started.
+func Follows(ctx context.Context, gql *graphql.GraphQL, userID string) ([]Follow, error) {
+	query := fmt.Sprintf(`
+query {
+	getUser(id: %q) {
+		id
+		follows(order: { asc: since }) {
+			id
+			since
+			until
+			friend {
+				id
+				source_id
+				source
+				screen_name
+				name
+				location
+				friends_count
+				last_synced
+			}
+		}
+	}
+}`, userID)
+
+	var result struct {
+		GetUser struct {
+			ID      string   `json:"id"`
+			Follows []Follow `json:"follows"`
+		} `json:"getUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	if result.GetUser.ID == "" {
+		return nil, ErrNotFound
+	}
+
+	return result.GetUser.Follows, nil
+}
+
+// Stale returns the users from the specified source that were last synced
+// before the specified time. Users that have never been synced are not
+// returned since their friends were never crawled.
+func Stale(ctx context.Context, gql *graphql.GraphQL, source string, before time.Time) ([]User, error) {
+	query := fmt.Sprintf(`
+query {
+	queryUser(filter: { source: { eq: %q }, and: { last_synced: { lt: %q } } }) {
+		id
+		source_id
+		source
+		screen_name
+		name
+		location
+		friends_count
+		last_synced
+	}
+}`, source, before.UTC().Format(time.RFC3339))
+
+	var result struct {
+		QueryUser []User `json:"queryUser"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	return result.QueryUser, nil
+}
+
+// BackfillKeys sets the key of every user stored before users had one, so
+// they can be found by key and paged in key order. A user with the same
+// source identity as a user that already has the key is a duplicate left by
+// an earlier race and is skipped. It returns the number of keys set and the
+// number of duplicates skipped.
+func BackfillKeys(ctx context.Context, gql *graphql.GraphQL) (keys int, duplicates int, err error) {
+	const pageSize = 100
+
+	for {
+		// The users that get a key drop out of the query, so only the
+		// duplicates skipped so far have to be paged over.
+		query := fmt.Sprintf(`
+{
+	users(func: type(User), first: %d, offset: %d) @filter(NOT has(User.key)) {
+		uid
+		User.source
+		User.source_id
+	}
+}`, pageSize, duplicates)
+
+		var result struct {
+			Users []struct {
+				UID      string `json:"uid"`
+				Source   string `json:"User.source"`
+				SourceID string `json:"User.source_id"`
+			} `json:"users"`
+		}
+		if err := gql.QueryPM(ctx, query, &result); err != nil {
+			return keys, duplicates, errors.Wrap(err, "query failed")
+		}
+
+		if len(result.Users) == 0 {
+			return keys, duplicates, nil
+		}
+
+		upsert := data.NewUpsert()
+		seen := make(map[string]bool)
+		var names []string
+		for i, u := range result.Users {
+			key := Key(u.Source, u.SourceID)
+			if seen[key] {
+				duplicates++
+				continue
+			}
+			seen[key] = true
+
+			name := fmt.Sprintf("k%d", i)
+			names = append(names, name)
+			upsert.Var(name, data.Eq("User.key", key)).
+				Mutate(data.Missing(name), data.Mutation{Set: map[string]interface{}{"uid": u.UID, "User.key": key}})
+		}
+
+		set, err := upsert.Exec(ctx, gql)
+		if err != nil {
+			return keys, duplicates, errors.Wrap(err, "failed to set keys")
+		}
+
+		for _, name := range names {
+			if len(set.Queries[name]) > 0 {
+				duplicates++
+				continue
+			}
+			keys++
+		}
+
+		if len(result.Users) < pageSize {
+			return keys, duplicates, nil
+		}
+	}
+}
+
+// BackfillFollows records a follow for every friend that has no open follow,
+// like the friends stored before follows were recorded. The time the follow
+// started isn't known, so it's recorded as starting when the user was last
+// synced, or at the specified time for users that were never synced. It
+// returns the number of follows recorded.
+func BackfillFollows(ctx context.Context, gql *graphql.GraphQL, at time.Time) (int, error) {
+	const pageSize = 100
+
+	var added int
+	for offset := 0; ; offset += pageSize {
+		query := fmt.Sprintf(`
+query {
+	queryUser(order: { asc: key }, first: %d, offset: %d) {
+		id
+		last_synced
+		friends {
+			id
+		}
+		follows {
+			until
+			friend {
+				id
+			}
+		}
+	}
+}`, pageSize, offset)
+
+		var result struct {
+			QueryUser []struct {
+				ID         string    `json:"id"`
+				LastSynced time.Time `json:"last_synced"`
+				Friends    []User    `json:"friends"`
+				Follows    []Follow  `json:"follows"`
+			} `json:"queryUser"`
+		}
+		if err := gql.Query(ctx, query, &result); err != nil {
+			return added, errors.Wrap(err, "query failed")
+		}
+
+		var inputs []string
+		for _, u := range result.QueryUser {
+			followed := make(map[string]bool)
+			for _, f := range open(u.Follows) {
+				followed[f.Friend.ID] = true
+			}
+
+			since := u.LastSynced
+			if since.IsZero() {
+				since = at
+			}
+
+			for _, friend := range u.Friends {
+				if !followed[friend.ID] {
+					inputs = append(inputs, prepareFollow(u.ID, friend.ID, since, time.Time{}))
+				}
+			}
+		}
+
+		if len(inputs) > 0 {
+			var result addFollowResult
+			mutation := fmt.Sprintf(`
+mutation {
+	addFollow(input: [%s])
+	%s
+}`, strings.Join(inputs, ", "), result.document())
+
+			if err := gql.Query(ctx, mutation, &result); err != nil {
+				return added, errors.Wrap(err, "failed to backfill follows")
+			}
+			added += result.AddFollow.NumUids
+		}
+
+		if len(result.QueryUser) < pageSize {
+			return added, nil
+		}
+	}
+}
+
+// Watch subscribes to the users matching the filter. The current profile of
+// every matching user is sent on the channel, followed by the profile of a
+// user every time it changes. The subscription is made with the same
+// configuration as the graphql value, which must be constructed by
+// data.NewGraphQL, and restarted when the connection is lost. The channel is
+// closed when the context is canceled, when the database rejects the
+// subscription or when a result can't be decoded.
+func Watch(ctx context.Context, gql *graphql.GraphQL, filter Filter) (<-chan User, error) {
+	sub, err := data.SubscriberFor(gql)
+	if err != nil {
+		return nil, errors.Wrap(err, "constructing subscriber")
+	}
+
+	subscription := `
+subscription($filter: UserFilter) {
+	queryUser(filter: $filter) {
+		id
+		source_id
+		source
+		screen_name
+		name
+		location
+		friends_count
+		last_synced
+	}
+}`
+
+	ctx, cancel := context.WithCancel(ctx)
+	pushes, err := sub.Subscribe(ctx, subscription, map[string]interface{}{"filter": filter.document()})
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "subscription failed")
+	}
+
+	ch := make(chan User)
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		// Every push holds every matching user, so only the users in the
+		// latest push are remembered to tell which of them changed.
+		var seen map[string]User
+		for push := range pushes {
+			if push.Err != nil {
+				return
+			}
+
+			var result struct {
+				QueryUser []User `json:"queryUser"`
+			}
+			if err := json.Unmarshal(push.Data, &result); err != nil {
+				return
+			}
+
+			latest := make(map[string]User, len(result.QueryUser))
+			for _, u := range result.QueryUser {
+				latest[u.ID] = u
+				if last, exists := seen[u.ID]; exists && reflect.DeepEqual(last, u) {
+					continue
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+			seen = latest
+		}
+	}()
+
+	return ch, nil
+}
+
+// =============================================================================
+
+func followsByKey(ctx context.Context, gql *graphql.GraphQL, key string) ([]Follow, error) {
+	query := fmt.Sprintf(`
+query {
+	queryFollow(filter: { key: { eq: %q } }) {
+		id
+		since
+		until
+	}
+}`, key)
+
+	var result struct {
+		QueryFollow []Follow `json:"queryFollow"`
+	}
+	if err := gql.Query(ctx, query, &result); err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+
+	return result.QueryFollow, nil
+}
+
+// prepareFollow returns the input that adds a follow over the period from
+// since to until. A zero until leaves the follow open.
+func prepareFollow(userID string, friendID string, since time.Time, until time.Time) string {
+	var end string
+	if !until.IsZero() {
+		end = fmt.Sprintf("\n\t\tuntil: %q", until.UTC().Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf(`{
+		key: %q
+		follower: { id: %q }
+		friend: { id: %q }
+		since: %q%s
+	}`, followKey(userID, friendID), userID, friendID, since.UTC().Format(time.RFC3339), end)
+}
+
+// followKey identifies every follow between the same two users.
+func followKey(userID string, friendID string) string {
+	return userID + "->" + friendID
+}
+
+// open returns the follows that haven't ended.
+func open(follows []Follow) []Follow {
+	var list []Follow
+	for _, f := range follows {
+		if f.Until.IsZero() {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// friendsAt returns the friends from the follow history that were being
+// followed at the specified time. A follow covers [since, until).
+func friendsAt(follows []Follow, at time.Time) []User {
+	var friends []User
+	seen := make(map[string]bool)
+	for _, f := range follows {
+		if f.Since.After(at) || (!f.Until.IsZero() && !f.Until.After(at)) {
+			continue
+		}
+		if !seen[f.Friend.ID] {
+			seen[f.Friend.ID] = true
+			friends = append(friends, f.Friend)
+		}
+	}
+	return friends
+}
+
+// Key returns the key that identifies a user from the specified source.
+func Key(source string, sourceID string) string {
+	return source + ":" + sourceID
+}
+
+// prepareAdd returns the predicates of a new user as a JSON mutation. The
+// user is a blank node named user so its id can be read from the result.
+func prepareAdd(user User) map[string]interface{} {
+	set := map[string]interface{}{
+		"uid":                "_:user",
+		"dgraph.type":        "User",
+		"User.key":           Key(user.Source, user.SourceID),
+		"User.source_id":     user.SourceID,
+		"User.source":        user.Source,
+		"User.screen_name":   user.ScreenName,
+		"User.name":          user.Name,
+		"User.location":      user.Location,
+		"User.friends_count": user.FriendsCount,
+	}
+	if !user.LastSynced.IsZero() {
+		set["User.last_synced"] = user.LastSynced.UTC().Format(time.RFC3339)
+	}
+
+	return set
+}
+
+// prepareUpdate returns the fields that are set in uu as the set clause of
+// an updateUser mutation.
+func prepareUpdate(uu UpdateUser) []string {
+	var set []string
+	if uu.ScreenName != nil {
+		set = append(set, fmt.Sprintf("screen_name: %q", *uu.ScreenName))
+	}
+	if uu.Name != nil {
+		set = append(set, fmt.Sprintf("name: %q", *uu.Name))
+	}
+	if uu.Location != nil {
+		set = append(set, fmt.Sprintf("location: %q", *uu.Location))
+	}
+	if uu.FriendsCount != nil {
+		set = append(set, fmt.Sprintf("friends_count: %d", *uu.FriendsCount))
+	}
+	if uu.LastSynced != nil {
+		set = append(set, fmt.Sprintf("last_synced: %q", uu.LastSynced.UTC().Format(time.RFC3339)))
+	}
+	if uu.PageRank != nil {
+		set = append(set, fmt.Sprintf("pagerank: %s", strconv.FormatFloat(*uu.PageRank, 'g', -1, 64)))
+	}
+	if uu.InDegree != nil {
+		set = append(set, fmt.Sprintf("in_degree: %d", *uu.InDegree))
+	}
+	if uu.OutDegree != nil {
+		set = append(set, fmt.Sprintf("out_degree: %d", *uu.OutDegree))
+	}
+	if uu.Betweenness != nil {
+		set = append(set, fmt.Sprintf("betweenness: %s", strconv.FormatFloat(*uu.Betweenness, 'g', -1, 64)))
+	}
+	if uu.Community != nil {
+		set = append(set, fmt.Sprintf("community: %d", *uu.Community))
+	}
+
+	return set
+}
+
+// prepareAddFriend returns the mutation that adds the friend to the user
+// bound to the user variable and removes it from the past friends.
+func prepareAddFriend(friendID string) data.Mutation {
+	return data.Mutation{
+		Set: map[string]interface{}{
+			"uid":          data.UID("user"),
+			"User.friends": []map[string]string{{"uid": friendID}},
+		},
+		Delete: map[string]interface{}{
+			"uid":               data.UID("user"),
+			"User.past_friends": []map[string]string{{"uid": friendID}},
+		},
+	}
+}
+
+// prepareRemoveFriend returns the mutation that moves the friend of the user
+// bound to the user variable to the past friends.
+func prepareRemoveFriend(friendID string) data.Mutation {
+	return data.Mutation{
+		Set: map[string]interface{}{
+			"uid":               data.UID("user"),
+			"User.past_friends": []map[string]string{{"uid": friendID}},
+		},
+		Delete: map[string]interface{}{
+			"uid":          data.UID("user"),
+			"User.friends": []map[string]string{{"uid": friendID}},
+		},
+	}
+}
+
+// prepareEndFollows returns the mutation that ends the follows bound to the
+// open variable at the specified time.
+func prepareEndFollows(until time.Time) data.Mutation {
+	return data.Mutation{
+		Set: map[string]interface{}{
+			"uid":          data.UID("open"),
+			"Follow.until": until.UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// prepareOpenFollow returns the mutation that starts a follow of the friend
+// by the user bound to the user variable. Both sides of the follows edge are
+// set since GraphQL only keeps the inverse for its own mutations.
+func prepareOpenFollow(userID string, friendID string, since time.Time) data.Mutation {
+	return data.Mutation{
+		Set: []map[string]interface{}{
+			{
+				"uid":             "_:follow",
+				"dgraph.type":     "Follow",
+				"Follow.key":      followKey(userID, friendID),
+				"Follow.follower": map[string]string{"uid": data.UID("user")},
+				"Follow.friend":   map[string]string{"uid": friendID},
+				"Follow.since":    since.UTC().Format(time.RFC3339),
+			},
+			{
+				"uid":          data.UID("user"),
+				"User.follows": []map[string]string{{"uid": "_:follow"}},
+			},
+		},
+	}
 }
 
 /*
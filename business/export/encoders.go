@@ -0,0 +1,281 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ardanlabs/dgraph/business/data/user"
+)
+
+// Encoder writes a graph one node or edge at a time. Every node is written
+// before the first edge. An edge needs the id and source identity of the
+// users it connects.
+type Encoder interface {
+	Begin() error
+	Node(u user.User) error
+	Edge(from user.User, to user.User) error
+	End() error
+}
+
+// NewEncoder constructs an Encoder that writes the specified format to w.
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case GraphML:
+		return &graphml{w: w}, nil
+	case GEXF:
+		return &gexf{w: w}, nil
+	case DOT:
+		return &dot{w: w}, nil
+	case RDF:
+		return &rdf{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// =============================================================================
+
+// graphml writes the GraphML format.
+type graphml struct {
+	w     io.Writer
+	edges int
+}
+
+func (g *graphml) Begin() error {
+	_, err := io.WriteString(g.w, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="screen_name" for="node" attr.name="screen_name" attr.type="string"/>
+  <key id="name" for="node" attr.name="name" attr.type="string"/>
+  <key id="location" for="node" attr.name="location" attr.type="string"/>
+  <key id="friends_count" for="node" attr.name="friends_count" attr.type="int"/>
+  <graph id="follows" edgedefault="directed">
+`)
+	return err
+}
+
+func (g *graphml) Node(u user.User) error {
+	_, err := fmt.Fprintf(g.w, `    <node id="%s">
+      <data key="screen_name">%s</data>
+      <data key="name">%s</data>
+      <data key="location">%s</data>
+      <data key="friends_count">%d</data>
+    </node>
+`, escape(u.ID), escape(u.ScreenName), escape(u.Name), escape(u.Location), u.FriendsCount)
+	return err
+}
+
+func (g *graphml) Edge(from user.User, to user.User) error {
+	_, err := fmt.Fprintf(g.w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"/>\n", g.edges, escape(from.ID), escape(to.ID))
+	g.edges++
+	return err
+}
+
+func (g *graphml) End() error {
+	_, err := io.WriteString(g.w, "  </graph>\n</graphml>\n")
+	return err
+}
+
+// =============================================================================
+
+// gexf writes the GEXF format used by Gephi. Nodes and edges are written in
+// separate sections, so the encoder tracks which section is open.
+type gexf struct {
+	w       io.Writer
+	edges   int
+	section string
+}
+
+func (g *gexf) Begin() error {
+	_, err := io.WriteString(g.w, `<?xml version="1.0" encoding="UTF-8"?>
+<gexf xmlns="http://www.gexf.net/1.2draft" version="1.2">
+  <graph mode="static" defaultedgetype="directed">
+    <attributes class="node">
+      <attribute id="0" title="screen_name" type="string"/>
+      <attribute id="1" title="name" type="string"/>
+      <attribute id="2" title="location" type="string"/>
+      <attribute id="3" title="friends_count" type="integer"/>
+    </attributes>
+`)
+	return err
+}
+
+func (g *gexf) Node(u user.User) error {
+	if err := g.open("nodes"); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(g.w, `      <node id="%s" label="%s">
+        <attvalues>
+          <attvalue for="0" value="%s"/>
+          <attvalue for="1" value="%s"/>
+          <attvalue for="2" value="%s"/>
+          <attvalue for="3" value="%d"/>
+        </attvalues>
+      </node>
+`, escape(u.ID), escape(u.ScreenName), escape(u.ScreenName), escape(u.Name), escape(u.Location), u.FriendsCount)
+	return err
+}
+
+func (g *gexf) Edge(from user.User, to user.User) error {
+	if err := g.open("edges"); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(g.w, "      <edge id=\"%d\" source=\"%s\" target=\"%s\"/>\n", g.edges, escape(from.ID), escape(to.ID))
+	g.edges++
+	return err
+}
+
+func (g *gexf) End() error {
+	if err := g.open(""); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(g.w, "  </graph>\n</gexf>\n")
+	return err
+}
+
+// open closes the current section and opens the specified one.
+func (g *gexf) open(section string) error {
+	if g.section == section {
+		return nil
+	}
+
+	if g.section != "" {
+		if _, err := fmt.Fprintf(g.w, "    </%s>\n", g.section); err != nil {
+			return err
+		}
+	}
+
+	g.section = section
+	if section == "" {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(g.w, "    <%s>\n", section)
+	return err
+}
+
+// =============================================================================
+
+// dot writes the DOT format used by Graphviz.
+type dot struct {
+	w io.Writer
+}
+
+func (d *dot) Begin() error {
+	_, err := io.WriteString(d.w, "digraph follows {\n")
+	return err
+}
+
+func (d *dot) Node(u user.User) error {
+	_, err := fmt.Fprintf(d.w, "  %s [label=%s, screen_name=%s, name=%s, location=%s, friends_count=%d];\n",
+		quote(u.ID), quote(u.ScreenName), quote(u.ScreenName), quote(u.Name), quote(u.Location), u.FriendsCount)
+	return err
+}
+
+func (d *dot) Edge(from user.User, to user.User) error {
+	_, err := fmt.Fprintf(d.w, "  %s -> %s;\n", quote(from.ID), quote(to.ID))
+	return err
+}
+
+func (d *dot) End() error {
+	_, err := io.WriteString(d.w, "}\n")
+	return err
+}
+
+// =============================================================================
+
+// rdf writes N-Quads that can be loaded by the dgraph live and bulk loaders.
+// Users are written as blank nodes keyed on their source identity so the
+// loader assigns new uids. Edges are labelled from the source identity of the
+// users they connect, so nothing is kept in memory.
+type rdf struct {
+	w io.Writer
+}
+
+func (r *rdf) Begin() error {
+	return nil
+}
+
+func (r *rdf) Node(u user.User) error {
+	label := blank(u.Source, u.SourceID)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s <dgraph.type> \"User\" .\n", label)
+	fmt.Fprintf(&b, "%s <User.key> %s .\n", label, literal(user.Key(u.Source, u.SourceID)))
+	fmt.Fprintf(&b, "%s <User.source_id> %s .\n", label, literal(u.SourceID))
+	fmt.Fprintf(&b, "%s <User.source> %s .\n", label, literal(u.Source))
+	fmt.Fprintf(&b, "%s <User.screen_name> %s .\n", label, literal(u.ScreenName))
+	fmt.Fprintf(&b, "%s <User.name> %s .\n", label, literal(u.Name))
+	if u.Location != "" {
+		fmt.Fprintf(&b, "%s <User.location> %s .\n", label, literal(u.Location))
+	}
+	fmt.Fprintf(&b, "%s <User.friends_count> \"%d\"^^<xs:int> .\n", label, u.FriendsCount)
+	if !u.LastSynced.IsZero() {
+		fmt.Fprintf(&b, "%s <User.last_synced> \"%s\"^^<xs:dateTime> .\n", label, u.LastSynced.UTC().Format(time.RFC3339))
+	}
+
+	_, err := io.WriteString(r.w, b.String())
+	return err
+}
+
+func (r *rdf) Edge(from user.User, to user.User) error {
+	_, err := fmt.Fprintf(r.w, "%s <User.friends> %s .\n", blank(from.Source, from.SourceID), blank(to.Source, to.SourceID))
+	return err
+}
+
+func (r *rdf) End() error {
+	return nil
+}
+
+// blank returns the blank node label for the user with the specified source
+// identity. The source and source id are separated by a dot, so dots inside
+// them are hex encoded along with the characters that can't be part of a
+// label. That keeps every identity on a label of its own and a label never
+// ends with a dot.
+func blank(source string, sourceID string) string {
+	var b strings.Builder
+	b.WriteString("_:")
+	writeLabel(&b, source)
+	b.WriteString(".")
+	writeLabel(&b, sourceID)
+	return b.String()
+}
+
+// writeLabel writes the text as part of a blank node label.
+func writeLabel(b *strings.Builder, text string) {
+	for _, c := range text {
+		switch {
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-'):
+			b.WriteRune(c)
+		default:
+			fmt.Fprintf(b, "_%x", c)
+		}
+	}
+}
+
+// literal returns the text as an N-Quads string literal.
+func literal(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// =============================================================================
+
+// escape returns the text escaped for use in xml content and attributes.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// quote returns the text as a DOT quoted string.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
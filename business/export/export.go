@@ -0,0 +1,194 @@
+// Package export provides support for writing the stored follow graph in
+// formats understood by graph tools like Gephi and Graphviz.
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/graphql"
+	"github.com/pkg/errors"
+)
+
+// Set of supported export formats.
+const (
+	GraphML = "graphml"
+	GEXF    = "gexf"
+	DOT     = "dot"
+	RDF     = "rdf"
+)
+
+// Config represents the settings for an export. If Ego is set, only the
+// user with that screen name, the users they follow and the edges between
+// them are exported.
+type Config struct {
+	Format   string
+	Ego      string
+	PageSize int
+}
+
+// Stats represents what was written by an export.
+type Stats struct {
+	Nodes int
+	Edges int
+}
+
+// FormatFromPath returns the format of the file based on its extension.
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".graphml":
+		return GraphML, nil
+	case ".gexf":
+		return GEXF, nil
+	case ".dot", ".gv":
+		return DOT, nil
+	case ".rdf", ".nq":
+		return RDF, nil
+	}
+
+	return "", fmt.Errorf("unknown export format for %q", path)
+}
+
+// Export writes the graph stored in the database to w. Users are read one
+// page at a time and written as they are read, so the graph never has to
+// fit in memory. Nodes are written in a first pass and edges in a second
+// since some formats require every node before the first edge.
+func Export(ctx context.Context, gql *graphql.GraphQL, w io.Writer, cfg Config) (Stats, error) {
+	enc, err := NewEncoder(w, cfg.Format)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 500
+	}
+
+	if err := enc.Begin(); err != nil {
+		return Stats{}, errors.Wrap(err, "writing header")
+	}
+
+	var stats Stats
+	switch cfg.Ego {
+	case "":
+		stats, err = all(ctx, gql, enc, cfg.PageSize)
+	default:
+		stats, err = ego(ctx, gql, enc, cfg.Ego)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	if err := enc.End(); err != nil {
+		return stats, errors.Wrap(err, "writing footer")
+	}
+
+	return stats, nil
+}
+
+// =============================================================================
+
+// all writes every user and friend edge in the database.
+func all(ctx context.Context, gql *graphql.GraphQL, enc Encoder, pageSize int) (Stats, error) {
+	var stats Stats
+
+	pages := func(f func(u user.User) error) error {
+		for offset := 0; ; offset += pageSize {
+			users, err := user.List(ctx, gql, offset, pageSize)
+			if err != nil {
+				return errors.Wrapf(err, "listing users at offset %d", offset)
+			}
+
+			for _, u := range users {
+				if err := f(u); err != nil {
+					return err
+				}
+			}
+
+			if len(users) < pageSize {
+				return nil
+			}
+		}
+	}
+
+	err := pages(func(u user.User) error {
+		stats.Nodes++
+		return enc.Node(u)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = pages(func(u user.User) error {
+		for _, f := range u.Friends {
+			stats.Edges++
+			if err := enc.Edge(u, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// ego writes the specified user, the users they follow and the friend edges
+// between all of them.
+func ego(ctx context.Context, gql *graphql.GraphQL, enc Encoder, screenName string) (Stats, error) {
+	root, err := user.OneByScreenName(ctx, gql, screenName)
+	if err != nil {
+		return Stats{}, errors.Wrapf(err, "retrieving user %q", screenName)
+	}
+
+	friends, err := user.Friends(ctx, gql, root.ID)
+	if err != nil {
+		return Stats{}, errors.Wrapf(err, "retrieving friends of %q", screenName)
+	}
+
+	members := append([]user.User{root}, friends...)
+	inside := make(map[string]bool, len(members))
+
+	var stats Stats
+	for _, u := range members {
+		if inside[u.ID] {
+			continue
+		}
+		inside[u.ID] = true
+
+		stats.Nodes++
+		if err := enc.Node(u); err != nil {
+			return stats, err
+		}
+	}
+
+	for _, u := range members[1:] {
+		stats.Edges++
+		if err := enc.Edge(root, u); err != nil {
+			return stats, err
+		}
+	}
+
+	// Only the edges between friends of the user are part of the network.
+	for _, u := range members[1:] {
+		friends, err := user.Friends(ctx, gql, u.ID)
+		if err != nil {
+			return stats, errors.Wrapf(err, "retrieving friends of %q", u.ScreenName)
+		}
+
+		for _, f := range friends {
+			if !inside[f.ID] {
+				continue
+			}
+
+			stats.Edges++
+			if err := enc.Edge(u, f); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,178 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/data/user"
+	"github.com/ardanlabs/dgraph/business/export"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+)
+
+// TestEncoders validates the graph formats can be read back.
+func TestEncoders(t *testing.T) {
+	users := []user.User{
+		{ID: "0x1", Source: "twitter", SourceID: "1", ScreenName: "goinggodotnet", Name: "William Kennedy", Location: "Miami", FriendsCount: 2},
+		{ID: "0x2", Source: "twitter", SourceID: "2", ScreenName: "jacksmith", Name: `Jack "The Hammer" <Smith>`, Location: "Miami & Tampa", FriendsCount: 1},
+		{ID: "0x3", Source: "twitter", SourceID: "3", ScreenName: "janedoe", Name: "Jane Doe"},
+	}
+	edges := [][2]user.User{{users[0], users[1]}, {users[0], users[2]}, {users[1], users[2]}}
+
+	encode := func(format string) (string, error) {
+		var buf bytes.Buffer
+		enc, err := export.NewEncoder(&buf, format)
+		if err != nil {
+			return "", err
+		}
+		if err := enc.Begin(); err != nil {
+			return "", err
+		}
+		for _, u := range users {
+			if err := enc.Node(u); err != nil {
+				return "", err
+			}
+		}
+		for _, e := range edges {
+			if err := enc.Edge(e[0], e[1]); err != nil {
+				return "", err
+			}
+		}
+		if err := enc.End(); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	t.Log("Given the need to export the graph for graph tools.")
+	{
+		for testID, format := range []string{export.GraphML, export.GEXF} {
+			t.Logf("\tTest %d:\tWhen exporting %d users and %d edges as %s.", testID, len(users), len(edges), format)
+			{
+				out, err := encode(format)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to encode the graph: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to encode the graph.", tests.Success, testID)
+
+				counts := make(map[string]int)
+				names := make(map[string]bool)
+				dec := xml.NewDecoder(strings.NewReader(out))
+				for {
+					tok, err := dec.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould be well formed xml: %v", tests.Failed, testID, err)
+					}
+
+					switch tok := tok.(type) {
+					case xml.StartElement:
+						counts[tok.Name.Local]++
+						for _, attr := range tok.Attr {
+							names[attr.Value] = true
+						}
+					case xml.CharData:
+						names[string(tok)] = true
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould be well formed xml.", tests.Success, testID)
+
+				if counts["node"] != len(users) || counts["edge"] != len(edges) {
+					t.Fatalf("\t%s\tTest %d:\tShould have %d nodes and %d edges, got %d and %d.", tests.Failed, testID, len(users), len(edges), counts["node"], counts["edge"])
+				}
+				t.Logf("\t%s\tTest %d:\tShould have %d nodes and %d edges.", tests.Success, testID, len(users), len(edges))
+
+				if !names[users[1].Name] || !names[users[1].Location] {
+					t.Fatalf("\t%s\tTest %d:\tShould keep attributes with special characters.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould keep attributes with special characters.", tests.Success, testID)
+			}
+		}
+
+		testID := 2
+		t.Logf("\tTest %d:\tWhen exporting %d users and %d edges as %s.", testID, len(users), len(edges), export.DOT)
+		{
+			out, err := encode(export.DOT)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encode the graph: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to encode the graph.", tests.Success, testID)
+
+			for _, exp := range []string{
+				"digraph follows {\n",
+				`name="Jack \"The Hammer\" <Smith>"`,
+				`"0x1" -> "0x2";`,
+				`"0x2" -> "0x3";`,
+			} {
+				if !strings.Contains(out, exp) {
+					t.Fatalf("\t%s\tTest %d:\tShould contain %s:\n%s", tests.Failed, testID, exp, out)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould contain the nodes and edges.", tests.Success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen exporting %d users and %d edges as %s.", testID, len(users), len(edges), export.RDF)
+		{
+			out, err := encode(export.RDF)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encode the graph: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to encode the graph.", tests.Success, testID)
+
+			for _, exp := range []string{
+				"_:twitter.1 <dgraph.type> \"User\" .\n",
+				"_:twitter.1 <User.key> \"twitter:1\" .\n",
+				"_:twitter.1 <User.source_id> \"1\" .\n",
+				"_:twitter.1 <User.friends_count> \"2\"^^<xs:int> .\n",
+				"_:twitter.2 <User.name> \"Jack \\\"The Hammer\\\" <Smith>\" .\n",
+				"_:twitter.1 <User.friends> _:twitter.2 .\n",
+				"_:twitter.2 <User.friends> _:twitter.3 .\n",
+			} {
+				if !strings.Contains(out, exp) {
+					t.Fatalf("\t%s\tTest %d:\tShould contain %s:\n%s", tests.Failed, testID, exp, out)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould contain the nodes and edges.", tests.Success, testID)
+
+			for i, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				if !strings.HasPrefix(line, "_:") || !strings.HasSuffix(line, " .") {
+					t.Fatalf("\t%s\tTest %d:\tShould write one quad per line, line %d: %s", tests.Failed, testID, i+1, line)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould write one quad per line.", tests.Success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen exporting users whose identities contain dots as %s.", testID, export.RDF)
+		{
+			var buf bytes.Buffer
+			enc, err := export.NewEncoder(&buf, export.RDF)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the encoder: %v", tests.Failed, testID, err)
+			}
+			for _, u := range []user.User{{Source: "a.b", SourceID: "c"}, {Source: "a", SourceID: "b.c"}, {Source: "a", SourceID: "b."}} {
+				if err := enc.Node(u); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to encode the user: %v", tests.Failed, testID, err)
+				}
+			}
+
+			labels := make(map[string]bool)
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				label := strings.Fields(line)[0]
+				if strings.HasSuffix(label, ".") {
+					t.Fatalf("\t%s\tTest %d:\tShould not end a label with a dot: %s", tests.Failed, testID, label)
+				}
+				labels[label] = true
+			}
+			if len(labels) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould give every user a label of its own, got %v.", tests.Failed, testID, labels)
+			}
+			t.Logf("\t%s\tTest %d:\tShould give every user a label of its own.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/ardanlabs/dgraph/foundation/file"
+)
+
+// Set of task kinds found in the frontier of a checkpoint.
+const (
+	taskExpand  = "expand"
+	taskHydrate = "hydrate"
+)
+
+// Task represents an api call that still has to be performed. An expand task
+// retrieves the friends of an account, a hydrate task retrieves its profile.
+type Task struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+}
+
+// Checkpoint represents the state of an interrupted crawl. Visited holds the
+// accounts already streamed, Waiting holds the followers found for accounts
+// that still need to be hydrated and Depth is the lowest level left to crawl.
+type Checkpoint struct {
+	Source   string              `json:"source"`
+	Root     User                `json:"root"`
+	Levels   int                 `json:"levels"`
+	Depth    int                 `json:"depth"`
+	Frontier []Task              `json:"frontier"`
+	Visited  []User              `json:"visited"`
+	Waiting  map[string][]string `json:"waiting,omitempty"`
+	Failed   []string            `json:"failed,omitempty"`
+}
+
+// SaveCheckpoint writes the checkpoint to the specified file. The file is
+// replaced atomically so a crash never leaves a partial checkpoint behind.
+func SaveCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	if err := file.WriteAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// LoadCheckpoint reads the checkpoint from the specified file.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return Checkpoint{}, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+
+	return cp, nil
+}
+
+// RemoveCheckpoint removes the checkpoint once a crawl is complete. A missing
+// file is not an error.
+func RemoveCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// checkpoint captures the state of the crawl. Jobs being performed by the
+// workers are part of the frontier since their results are not known yet,
+// and so are the jobs whose results could not be stored.
+func (s *state) checkpoint(source string) Checkpoint {
+	cp := Checkpoint{
+		Source:  source,
+		Root:    s.root,
+		Levels:  s.levels,
+		Depth:   s.levels,
+		Waiting: s.waiting,
+	}
+
+	jobs := make([]job, 0, s.pending()+len(s.deferred))
+	for _, j := range s.inflight {
+		jobs = append(jobs, j)
+	}
+	jobs = append(jobs, s.queue...)
+	jobs = append(jobs, s.deferred...)
+
+	for _, j := range jobs {
+		kind := taskHydrate
+		if j.kind == jobExpand {
+			kind = taskExpand
+		}
+		cp.Frontier = append(cp.Frontier, Task{Kind: kind, ID: j.id, Level: j.level})
+
+		if j.level < cp.Depth {
+			cp.Depth = j.level
+		}
+	}
+
+	for _, u := range s.users {
+		cp.Visited = append(cp.Visited, u)
+	}
+	sort.Slice(cp.Visited, func(i, j int) bool {
+		return cp.Visited[i].SourceID < cp.Visited[j].SourceID
+	})
+
+	for id := range s.failed {
+		cp.Failed = append(cp.Failed, id)
+	}
+	sort.Strings(cp.Failed)
+
+	return cp
+}
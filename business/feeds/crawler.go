@@ -0,0 +1,456 @@
+// Package feeds provides support for crawling the social graph of an account
+// from any supported source and streaming the accounts that are found.
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/dgraph/foundation/rate"
+)
+
+// Config represents the settings for running a crawl. If a checkpoint path
+// is provided, the state of the crawl is saved to it periodically and when
+// the crawl is interrupted so the crawl can be resumed. When Acknowledge is
+// set, every result without an error must be acknowledged with Crawler.Ack
+// before the next result is sent.
+type Config struct {
+	Workers         int
+	Levels          int
+	Interval        time.Duration
+	Burst           int
+	Checkpoint      string
+	CheckpointEvery time.Duration
+	Acknowledge     bool
+}
+
+// Result represents an account found during a crawl. Followers contains the
+// ids of the crawled accounts that follow User. The root account is the only
+// result without followers. If the account could not be retrieved, Err is
+// set and only the ID of User is known.
+type Result struct {
+	User      User
+	Followers []string
+	Level     int
+	Err       error
+}
+
+// Crawler walks the friends of an account using a bounded set of workers
+// that share a single rate limiter.
+type Crawler struct {
+	source          Source
+	limiter         *rate.Limiter
+	workers         int
+	levels          int
+	checkpoint      string
+	checkpointEvery time.Duration
+	acknowledge     bool
+	acks            chan error
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewCrawler constructs a Crawler for use.
+func NewCrawler(source Source, cfg Config) *Crawler {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	every := cfg.CheckpointEvery
+	if every <= 0 {
+		every = 10 * time.Second
+	}
+
+	return &Crawler{
+		source:          source,
+		limiter:         rate.New(cfg.Interval, cfg.Burst),
+		workers:         workers,
+		levels:          cfg.Levels,
+		checkpoint:      cfg.Checkpoint,
+		checkpointEvery: every,
+		acknowledge:     cfg.Acknowledge,
+		acks:            make(chan error, 1),
+	}
+}
+
+// Crawl starts crawling the friends of the specified root account. Results
+// are streamed over the returned channel as soon as they are available. The
+// channel is closed when the crawl is complete or the context is done.
+func (c *Crawler) Crawl(ctx context.Context, root User) <-chan Result {
+	s := newState(root, c.levels)
+	if c.levels > 0 {
+		s.push(job{kind: jobExpand, id: root.SourceID})
+	}
+
+	out := make(chan Result)
+
+	go func() {
+		defer close(out)
+
+		// Nothing found by the crawl can be stored without the root.
+		if sent, err := c.emit(ctx, out, Result{User: root}); !sent || err != nil {
+			return
+		}
+		c.coordinate(ctx, s, out)
+	}()
+
+	return out
+}
+
+// Resume continues a crawl from a checkpoint using the levels the crawl was
+// started with. Results that were streamed before the checkpoint was saved
+// are not streamed again.
+func (c *Crawler) Resume(ctx context.Context, cp Checkpoint) (<-chan Result, error) {
+	if cp.Source != c.source.Name() {
+		return nil, fmt.Errorf("checkpoint is for source %q, not %q", cp.Source, c.source.Name())
+	}
+
+	s := newState(cp.Root, cp.Levels)
+	for _, u := range cp.Visited {
+		s.users[u.SourceID] = u
+	}
+	for id, followers := range cp.Waiting {
+		s.waiting[id] = followers
+	}
+	for _, id := range cp.Failed {
+		s.failed[id] = true
+	}
+	for _, t := range cp.Frontier {
+		kind := jobHydrate
+		if t.Kind == taskExpand {
+			kind = jobExpand
+		}
+		s.push(job{kind: kind, id: t.ID, level: t.Level})
+	}
+
+	out := make(chan Result)
+
+	go func() {
+		defer close(out)
+		c.coordinate(ctx, s, out)
+	}()
+
+	return out, nil
+}
+
+// Ack acknowledges the last result received from a crawl configured to wait
+// for acknowledgements. A nil error means the result was stored. A user is
+// only recorded as visited once its result is stored, otherwise the user is
+// left for a resumed crawl to find again.
+func (c *Crawler) Ack(err error) {
+	select {
+	case c.acks <- err:
+	default:
+	}
+}
+
+// Err returns the error that kept the crawl from saving or removing its
+// checkpoint. It's only valid once the channel of results is closed. When
+// it's set, the checkpoint file can't be used to resume the crawl.
+func (c *Crawler) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// setErr records the outcome of the last checkpoint operation.
+func (c *Crawler) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = err
+}
+
+// =============================================================================
+
+// Set of job kinds a worker can perform.
+const (
+	jobHydrate = iota
+	jobExpand
+)
+
+// job represents a single api call to be performed by a worker.
+type job struct {
+	kind  int
+	id    string
+	level int
+
+	// Set by the worker once the job is performed.
+	user    User
+	friends []string
+	err     error
+}
+
+// key uniquely identifies the job while it's being performed.
+func (j job) key() string {
+	return fmt.Sprintf("%d:%s", j.kind, j.id)
+}
+
+// state represents everything known about a crawl in progress. Jobs whose
+// results could not be stored are deferred to a resumed crawl.
+type state struct {
+	root     User
+	levels   int
+	users    map[string]User
+	waiting  map[string][]string
+	failed   map[string]bool
+	queue    []job
+	inflight map[string]job
+	deferred []job
+}
+
+// newState constructs the state for a crawl starting at the root account.
+func newState(root User, levels int) *state {
+	return &state{
+		root:     root,
+		levels:   levels,
+		users:    map[string]User{root.SourceID: root},
+		waiting:  make(map[string][]string),
+		failed:   make(map[string]bool),
+		inflight: make(map[string]job),
+	}
+}
+
+// push adds a job to the frontier.
+func (s *state) push(j job) {
+	s.queue = append(s.queue, job{kind: j.kind, id: j.id, level: j.level})
+}
+
+// pending returns the number of jobs queued or being performed.
+func (s *state) pending() int {
+	return len(s.queue) + len(s.inflight)
+}
+
+// later defers the job to a resumed crawl.
+func (s *state) later(j job) {
+	for _, d := range s.deferred {
+		if d.key() == j.key() {
+			return
+		}
+	}
+	s.deferred = append(s.deferred, job{kind: j.kind, id: j.id, level: j.level})
+}
+
+// wait records the follower is waiting for the account to be hydrated.
+func (s *state) wait(id string, follower string) {
+	for _, f := range s.waiting[id] {
+		if f == follower {
+			return
+		}
+	}
+	s.waiting[id] = append(s.waiting[id], follower)
+}
+
+// emit sends the result unless the context is done first. When results are
+// acknowledged, it waits for the acknowledgement and returns its error.
+func (c *Crawler) emit(ctx context.Context, out chan<- Result, r Result) (bool, error) {
+	select {
+	case out <- r:
+	case <-ctx.Done():
+		return false, nil
+	}
+
+	if !c.acknowledge || r.Err != nil {
+		return true, nil
+	}
+
+	select {
+	case err := <-c.acks:
+		return true, err
+	case <-ctx.Done():
+		return false, nil
+	}
+}
+
+// coordinate owns all the crawl state. Workers only perform api calls and
+// report back, so no locking is required for the state.
+func (c *Crawler) coordinate(ctx context.Context, s *state, out chan<- Result) {
+	jobs := make(chan job)
+	done := make(chan job)
+
+	var wg sync.WaitGroup
+	wg.Add(c.workers)
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			defer wg.Done()
+			c.worker(ctx, jobs, done)
+		}()
+	}
+
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	var tick <-chan time.Time
+	if c.checkpoint != "" {
+		ticker := time.NewTicker(c.checkpointEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// When the crawl is interrupted, save where we are so it can be resumed.
+	// A complete crawl has nothing left to resume unless some results could
+	// not be stored.
+	defer func() {
+		if c.checkpoint == "" {
+			return
+		}
+		if s.pending() == 0 && len(s.deferred) == 0 {
+			c.setErr(RemoveCheckpoint(c.checkpoint))
+			return
+		}
+		c.setErr(SaveCheckpoint(c.checkpoint, s.checkpoint(c.source.Name())))
+	}()
+
+	for s.pending() > 0 {
+		var send chan<- job
+		var next job
+		if len(s.queue) > 0 {
+			send = jobs
+			next = s.queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-tick:
+
+			// A failed save leaves the previous checkpoint in place,
+			// which is still valid to resume from. The error stands
+			// unless the save when the crawl stops succeeds.
+			c.setErr(SaveCheckpoint(c.checkpoint, s.checkpoint(c.source.Name())))
+
+		case send <- next:
+			s.queue = s.queue[1:]
+			s.inflight[next.key()] = next
+
+		case j := <-done:
+			delete(s.inflight, j.key())
+
+			// A job that failed because the crawl is being stopped
+			// is not a failure of the account.
+			if j.err != nil && ctx.Err() != nil {
+				s.push(j)
+				return
+			}
+
+			var ok bool
+			switch j.kind {
+			case jobExpand:
+				ok = c.expanded(ctx, s, j, out)
+			case jobHydrate:
+				ok = c.hydrated(ctx, s, j, out)
+			}
+
+			// The results of a job that could not be streamed are
+			// produced again when the crawl is resumed.
+			if !ok {
+				s.push(j)
+				return
+			}
+		}
+	}
+}
+
+// expanded handles the friends retrieved for an account. Edges to accounts
+// that are already known are streamed right away, new accounts are queued
+// to be hydrated.
+func (c *Crawler) expanded(ctx context.Context, s *state, j job, out chan<- Result) bool {
+	if j.err != nil {
+		sent, _ := c.emit(ctx, out, Result{User: s.users[j.id], Level: j.level, Err: j.err})
+		return sent
+	}
+
+	for _, id := range j.friends {
+		switch u, exists := s.users[id]; {
+		case exists:
+			sent, err := c.emit(ctx, out, Result{User: u, Followers: []string{j.id}, Level: j.level + 1})
+			if !sent {
+				return false
+			}
+
+			// The edge is found again by expanding the account
+			// when the crawl is resumed.
+			if err != nil {
+				s.later(j)
+			}
+
+		case s.failed[id]:
+			// The account could not be retrieved so the
+			// edge can't be stored.
+
+		default:
+			if _, exists := s.waiting[id]; !exists {
+				s.push(job{kind: jobHydrate, id: id, level: j.level + 1})
+			}
+			s.wait(id, j.id)
+		}
+	}
+
+	return true
+}
+
+// hydrated handles the profile retrieved for an account. The account is
+// streamed with every follower found so far and queued to be expanded if
+// it's not at the last level.
+func (c *Crawler) hydrated(ctx context.Context, s *state, j job, out chan<- Result) bool {
+	followers := s.waiting[j.id]
+
+	if j.err != nil {
+		if sent, _ := c.emit(ctx, out, Result{User: User{SourceID: j.id}, Followers: followers, Level: j.level, Err: j.err}); !sent {
+			return false
+		}
+		delete(s.waiting, j.id)
+		s.failed[j.id] = true
+		return true
+	}
+
+	sent, err := c.emit(ctx, out, Result{User: j.user, Followers: followers, Level: j.level})
+	if !sent {
+		return false
+	}
+
+	// An account that wasn't stored isn't visited. It keeps collecting
+	// followers and is hydrated again when the crawl is resumed.
+	if err != nil {
+		s.later(j)
+		return true
+	}
+	delete(s.waiting, j.id)
+	s.users[j.id] = j.user
+
+	if j.level < s.levels {
+		s.push(job{kind: jobExpand, id: j.id, level: j.level})
+	}
+
+	return true
+}
+
+// worker performs the api calls for the jobs it receives.
+func (c *Crawler) worker(ctx context.Context, jobs <-chan job, done chan<- job) {
+	for j := range jobs {
+		switch err := c.limiter.Wait(ctx); {
+		case err != nil:
+			j.err = err
+
+		case j.kind == jobExpand:
+			j.friends, j.err = c.source.RetrieveFriends(ctx, j.id)
+
+		default:
+			j.user, j.err = c.source.RetrieveUserByID(ctx, j.id)
+		}
+
+		select {
+		case done <- j:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package feeds_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/twitter"
+	"github.com/ardanlabs/dgraph/business/feeds/twitter/twittertest"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestCrawler validates crawls against a fake twitter API.
+func TestCrawler(t *testing.T) {
+	t.Run("levels", levels)
+	t.Run("faults", faults)
+	t.Run("cancel", cancel)
+	t.Run("resume", resume)
+	t.Run("acknowledge", acknowledge)
+}
+
+// crawl runs a crawl from the first user in the graph. It returns the ids
+// of the users found and the edges found as "follower->friend" strings.
+func crawl(ctx context.Context, server *twittertest.Server, graph twittertest.Graph, levels int) (users []string, edges []string, errs []error) {
+	log := log.New(ioutil.Discard, "", 0)
+	tw := twitter.New(log, "token", twitter.WithBaseURL(server.URL))
+
+	root, err := tw.RetrieveUser(ctx, graph.Users[0].ScreenName)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	seen := make(map[string]bool)
+
+	crawler := feeds.NewCrawler(tw, feeds.Config{Workers: 4, Levels: levels})
+	for result := range crawler.Crawl(ctx, root) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+
+		if !seen[result.User.SourceID] {
+			seen[result.User.SourceID] = true
+			users = append(users, result.User.SourceID)
+		}
+		for _, follower := range result.Followers {
+			edges = append(edges, follower+"->"+result.User.SourceID)
+		}
+	}
+
+	sort.Strings(users)
+	sort.Strings(edges)
+	return users, edges, errs
+}
+
+// expected walks the graph the same way the crawler should.
+func expected(graph twittertest.Graph, levels int) (users []string, edges []string) {
+	root := graph.Users[0].ID
+	seen := map[int64]bool{root: true}
+	users = append(users, strconv.FormatInt(root, 10))
+
+	frontier := []int64{root}
+	for level := 0; level < levels; level++ {
+		var next []int64
+		for _, id := range frontier {
+			for _, friend := range graph.Friends[id] {
+				edges = append(edges, strconv.FormatInt(id, 10)+"->"+strconv.FormatInt(friend, 10))
+				if !seen[friend] {
+					seen[friend] = true
+					users = append(users, strconv.FormatInt(friend, 10))
+					next = append(next, friend)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	sort.Strings(users)
+	sort.Strings(edges)
+	return users, edges
+}
+
+// levels validates multi-level crawls find every user and edge exactly once.
+func levels(t *testing.T) {
+	graph := twittertest.Generate(60, 6, 1)
+	server := twittertest.NewServer(graph, twittertest.WithPageSize(4))
+	t.Cleanup(server.Close)
+
+	t.Log("Given the need to crawl multiple levels of friends.")
+	{
+		for testID, lvls := range []int{0, 1, 2, 3} {
+			t.Logf("\tTest %d:\tWhen crawling %d levels with paged friend ids.", testID, lvls)
+			{
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				users, edges, errs := crawl(ctx, server, graph, lvls)
+				if len(errs) != 0 {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to crawl without errors: %v", tests.Failed, testID, errs)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to crawl without errors.", tests.Success, testID)
+
+				expUsers, expEdges := expected(graph, lvls)
+				if diff := cmp.Diff(expUsers, users); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould find every user once. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould find every user once.", tests.Success, testID)
+
+				if diff := cmp.Diff(expEdges, edges); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould find every edge once. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould find every edge once.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// faults validates rate limiting and server errors are retried.
+func faults(t *testing.T) {
+	type tableTest struct {
+		name    string
+		options []func(s *twittertest.Server)
+	}
+
+	tt := []tableTest{
+		{"ratelimit", []func(s *twittertest.Server){twittertest.WithRateLimit(8, time.Second)}},
+		{"errors", []func(s *twittertest.Server){twittertest.WithErrors(3, http.StatusServiceUnavailable)}},
+	}
+
+	graph := twittertest.Generate(12, 3, 2)
+
+	t.Log("Given the need to recover from a failing twitter API.")
+	{
+		for testID, test := range tt {
+			tf := func(t *testing.T) {
+				t.Logf("\tTest %d:\tWhen crawling 2 levels against %s.", testID, test.name)
+				{
+					server := twittertest.NewServer(graph, test.options...)
+					defer server.Close()
+
+					ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+					defer cancel()
+
+					users, edges, errs := crawl(ctx, server, graph, 2)
+					if len(errs) != 0 {
+						t.Fatalf("\t%s\tTest %d:\tShould be able to crawl without errors: %v", tests.Failed, testID, errs)
+					}
+					t.Logf("\t%s\tTest %d:\tShould be able to crawl without errors.", tests.Success, testID)
+
+					expUsers, expEdges := expected(graph, 2)
+					if !cmp.Equal(expUsers, users) || !cmp.Equal(expEdges, edges) {
+						t.Fatalf("\t%s\tTest %d:\tShould find every user and edge.", tests.Failed, testID)
+					}
+					t.Logf("\t%s\tTest %d:\tShould find every user and edge.", tests.Success, testID)
+				}
+			}
+			t.Run(test.name, tf)
+		}
+	}
+}
+
+// cancel validates a crawl stops when the context is done.
+func cancel(t *testing.T) {
+	graph := twittertest.Generate(30, 5, 3)
+	server := twittertest.NewServer(graph, twittertest.WithLatency(50*time.Millisecond))
+	t.Cleanup(server.Close)
+
+	t.Log("Given the need to stop a crawl that takes too long.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the context times out during the crawl.", testID)
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			done := make(chan struct{})
+			go func() {
+				crawl(ctx, server, graph, 3)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould stop the crawl when the context is done.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop the crawl when the context is done.", tests.Success, testID)
+		}
+	}
+}
+
+// resume validates an interrupted crawl can be continued from its checkpoint
+// and that together both runs find every user and edge.
+func resume(t *testing.T) {
+	graph := twittertest.Generate(40, 5, 4)
+	server := twittertest.NewServer(graph, twittertest.WithLatency(20*time.Millisecond))
+	t.Cleanup(server.Close)
+
+	log := log.New(ioutil.Discard, "", 0)
+	tw := twitter.New(log, "token", twitter.WithBaseURL(server.URL))
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := feeds.Config{Workers: 2, Levels: 2, Checkpoint: filepath.Join(dir, "crawl.checkpoint")}
+
+	users := make(map[string]bool)
+	edges := make(map[string]bool)
+	collect := func(results <-chan feeds.Result) {
+		for result := range results {
+			if result.Err != nil {
+				t.Fatalf("\t%s\tShould be able to crawl without errors: %v", tests.Failed, result.Err)
+			}
+			users[result.User.SourceID] = true
+			for _, follower := range result.Followers {
+				edges[follower+"->"+result.User.SourceID] = true
+			}
+		}
+	}
+
+	t.Log("Given the need to continue a crawl that was interrupted.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the context times out and the crawl is resumed.", testID)
+		{
+			ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+			defer cancel()
+
+			root, err := tw.RetrieveUser(context.Background(), graph.Users[0].ScreenName)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the root user: %v", tests.Failed, testID, err)
+			}
+			collect(feeds.NewCrawler(tw, cfg).Crawl(ctx, root))
+
+			cp, err := feeds.LoadCheckpoint(cfg.Checkpoint)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould save a checkpoint when interrupted: %v", tests.Failed, testID, err)
+			}
+			if len(cp.Frontier) == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould save a checkpoint with work left to do.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould save a checkpoint when interrupted.", tests.Success, testID)
+
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			results, err := feeds.NewCrawler(tw, cfg).Resume(ctx, cp)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resume the crawl: %v", tests.Failed, testID, err)
+			}
+			collect(results)
+			t.Logf("\t%s\tTest %d:\tShould be able to resume the crawl.", tests.Success, testID)
+
+			if _, err := os.Stat(cfg.Checkpoint); !os.IsNotExist(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould remove the checkpoint once complete.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould remove the checkpoint once complete.", tests.Success, testID)
+
+			expUsers, expEdges := expected(graph, 2)
+			if diff := cmp.Diff(expUsers, keys(users)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould find every user. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			if diff := cmp.Diff(expEdges, keys(edges)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould find every edge. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find every user and edge.", tests.Success, testID)
+		}
+	}
+}
+
+// acknowledge validates users whose results are not stored are left for a
+// resumed crawl and that a checkpoint that can't be saved is reported.
+func acknowledge(t *testing.T) {
+	graph := twittertest.Generate(20, 4, 5)
+	server := twittertest.NewServer(graph)
+	t.Cleanup(server.Close)
+
+	log := log.New(ioutil.Discard, "", 0)
+	tw := twitter.New(log, "token", twitter.WithBaseURL(server.URL))
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := feeds.Config{Workers: 2, Levels: 2, Checkpoint: filepath.Join(dir, "crawl.checkpoint"), Acknowledge: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	root, err := tw.RetrieveUser(ctx, graph.Users[0].ScreenName)
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to retrieve the root user: %v", tests.Failed, err)
+	}
+
+	t.Log("Given the need to only visit the users that were stored.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user can't be stored and the crawl is resumed.", testID)
+		{
+			users := make(map[string]bool)
+			edges := make(map[string]bool)
+
+			var rejected string
+			crawler := feeds.NewCrawler(tw, cfg)
+			for result := range crawler.Crawl(ctx, root) {
+				if result.Err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to crawl without errors: %v", tests.Failed, testID, result.Err)
+				}
+				if rejected == "" && result.Level == 1 && len(result.Followers) > 0 {
+					rejected = result.User.SourceID
+					crawler.Ack(errors.New("database unavailable"))
+					continue
+				}
+				users[result.User.SourceID] = true
+				for _, follower := range result.Followers {
+					edges[follower+"->"+result.User.SourceID] = true
+				}
+				crawler.Ack(nil)
+			}
+			if err := crawler.Err(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to save the checkpoint: %v", tests.Failed, testID, err)
+			}
+
+			cp, err := feeds.LoadCheckpoint(cfg.Checkpoint)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep a checkpoint for the user not stored: %v", tests.Failed, testID, err)
+			}
+			for _, u := range cp.Visited {
+				if u.SourceID == rejected {
+					t.Fatalf("\t%s\tTest %d:\tShould not record the user not stored as visited.", tests.Failed, testID)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep a checkpoint for the user not stored.", tests.Success, testID)
+
+			crawler = feeds.NewCrawler(tw, cfg)
+			results, err := crawler.Resume(ctx, cp)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resume the crawl: %v", tests.Failed, testID, err)
+			}
+			for result := range results {
+				users[result.User.SourceID] = true
+				for _, follower := range result.Followers {
+					edges[follower+"->"+result.User.SourceID] = true
+				}
+				crawler.Ack(nil)
+			}
+
+			if _, err := os.Stat(cfg.Checkpoint); !os.IsNotExist(err) {
+				t.Fatalf("\t%s\tTest %d:\tShould remove the checkpoint once every user is stored.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould remove the checkpoint once every user is stored.", tests.Success, testID)
+
+			expUsers, expEdges := expected(graph, 2)
+			if diff := cmp.Diff(expUsers, keys(users)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould find every user. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			if diff := cmp.Diff(expEdges, keys(edges)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould find every edge. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find every user and edge.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the checkpoint can't be saved.", testID)
+		{
+			// The checkpoint can't be written below a regular file.
+			blocker := filepath.Join(dir, "blocker")
+			if err := ioutil.WriteFile(blocker, nil, 0644); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a file: %v", tests.Failed, testID, err)
+			}
+
+			cfg := cfg
+			cfg.Checkpoint = filepath.Join(blocker, "crawl.checkpoint")
+
+			crawler := feeds.NewCrawler(tw, cfg)
+			for result := range crawler.Crawl(ctx, root) {
+				if result.User.SourceID == root.SourceID {
+					crawler.Ack(nil)
+					continue
+				}
+				crawler.Ack(errors.New("database unavailable"))
+			}
+
+			if crawler.Err() == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould report the checkpoint was not saved.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the checkpoint was not saved.", tests.Success, testID)
+		}
+	}
+}
+
+// keys returns the keys of the set in sorted order.
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
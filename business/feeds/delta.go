@@ -0,0 +1,31 @@
+package feeds
+
+// Delta compares the source ids of the friends currently stored for an
+// account with the latest friends from the source. It returns the ids that
+// were followed and unfollowed since the friends were stored.
+func Delta(stored []string, latest []string) (added []string, removed []string) {
+	current := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		current[id] = true
+	}
+
+	seen := make(map[string]bool, len(latest))
+	for _, id := range latest {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if !current[id] {
+			added = append(added, id)
+		}
+	}
+
+	for _, id := range stored {
+		if !seen[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	return added, removed
+}
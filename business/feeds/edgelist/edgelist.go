@@ -0,0 +1,365 @@
+// Package edgelist provides support for reading an exported follow graph
+// from a file of users and follow edges. The graph can be used as a source
+// for the crawler or loaded into the database directly.
+//
+// Both CSV and JSON Lines files are supported. Each line holds one record
+// that is either a user or a follow edge between two users.
+//
+//	user,<source_id>,<screen_name>,<name>,<location>,<friends_count>
+//	follow,<source_id>,<friend_id>
+//
+//	{"type":"user","source_id":"1","screen_name":"bill","name":"Bill","location":"Miami","friends_count":1}
+//	{"type":"follow","source_id":"1","friend_id":"2"}
+//
+// Blank lines and CSV lines starting with # are ignored. A CSV file may start
+// with a header line whose first column is "type".
+package edgelist
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+)
+
+// Set of supported file formats.
+const (
+	CSV   = "csv"
+	JSONL = "jsonl"
+)
+
+// Set of record types found in a file.
+const (
+	typeUser   = "user"
+	typeFollow = "follow"
+)
+
+// ErrNotFound is returned when a user is not part of the graph.
+var ErrNotFound = errors.New("user not found")
+
+// LineError represents a record in the file that is not valid.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface.
+func (le LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", le.Line, le.Err)
+}
+
+// Edge represents one user following another.
+type Edge struct {
+	Line     int
+	SourceID string
+	FriendID string
+}
+
+// Graph represents the users and follow edges read from a file.
+type Graph struct {
+	source  string
+	users   []feeds.User
+	index   map[string]int
+	lines   map[string]int
+	names   map[string]string
+	friends map[string][]string
+	edges   []Edge
+	errors  []LineError
+}
+
+// Open reads the graph from the specified file. The format is determined
+// by the file extension. The source is the name of the network the users
+// were exported from.
+func Open(path string, source string) (*Graph, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening edge list: %w", err)
+	}
+	defer f.Close()
+
+	return Load(f, format, source)
+}
+
+// FormatFromPath returns the format of the file based on its extension.
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, nil
+	case ".jsonl", ".ndjson":
+		return JSONL, nil
+	}
+
+	return "", fmt.Errorf("unknown edge list format for %q", path)
+}
+
+// Load reads the graph from the reader in the specified format. Records
+// that fail validation are skipped and reported by the Errors method. An
+// error is only returned if the reader can't be read.
+func Load(r io.Reader, format string, source string) (*Graph, error) {
+	var parse func(line string) (record, error)
+	switch format {
+	case CSV:
+		parse = parseCSV
+	case JSONL:
+		parse = parseJSON
+	default:
+		return nil, fmt.Errorf("unknown edge list format %q", format)
+	}
+
+	g := Graph{
+		source:  source,
+		index:   make(map[string]int),
+		lines:   make(map[string]int),
+		names:   make(map[string]string),
+		friends: make(map[string][]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || (format == CSV && strings.HasPrefix(text, "#")) {
+			continue
+		}
+
+		rec, err := parse(text)
+		if err != nil {
+			g.errors = append(g.errors, LineError{Line: line, Err: err})
+			continue
+		}
+
+		switch rec.Type {
+		case "type":
+			if line != 1 {
+				g.errors = append(g.errors, LineError{Line: line, Err: errors.New("header must be the first line")})
+			}
+
+		case typeUser:
+			if err := g.addUser(line, rec); err != nil {
+				g.errors = append(g.errors, LineError{Line: line, Err: err})
+			}
+
+		case typeFollow:
+			if err := validateFollow(rec); err != nil {
+				g.errors = append(g.errors, LineError{Line: line, Err: err})
+				continue
+			}
+			g.edges = append(g.edges, Edge{Line: line, SourceID: rec.SourceID, FriendID: rec.FriendID})
+
+		default:
+			g.errors = append(g.errors, LineError{Line: line, Err: fmt.Errorf("unknown record type %q", rec.Type)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading edge list: %w", err)
+	}
+
+	// Edges can only be validated once every user is known since a follow
+	// can appear before the users it references.
+	edges := g.edges[:0]
+	for _, e := range g.edges {
+		switch {
+		case g.lines[e.SourceID] == 0:
+			g.errors = append(g.errors, LineError{Line: e.Line, Err: fmt.Errorf("unknown user %q", e.SourceID)})
+		case g.lines[e.FriendID] == 0:
+			g.errors = append(g.errors, LineError{Line: e.Line, Err: fmt.Errorf("unknown friend %q", e.FriendID)})
+		default:
+			edges = append(edges, e)
+			g.friends[e.SourceID] = append(g.friends[e.SourceID], e.FriendID)
+		}
+	}
+	g.edges = edges
+
+	sort.SliceStable(g.errors, func(i, j int) bool {
+		return g.errors[i].Line < g.errors[j].Line
+	})
+
+	for i := range g.users {
+		for _, id := range g.friends[g.users[i].SourceID] {
+			g.users[i].Friends = append(g.users[i].Friends, g.users[g.index[id]])
+		}
+	}
+
+	return &g, nil
+}
+
+// Users returns the users in the order they appear in the file. Each user
+// includes the users they follow.
+func (g *Graph) Users() []feeds.User {
+	return g.users
+}
+
+// Edges returns the follow edges in the order they appear in the file.
+func (g *Graph) Edges() []Edge {
+	return g.edges
+}
+
+// Errors returns the records that failed validation.
+func (g *Graph) Errors() []LineError {
+	return g.errors
+}
+
+// Line returns the line that defines the specified user.
+func (g *Graph) Line(sourceID string) int {
+	return g.lines[sourceID]
+}
+
+// Name returns the name of the source the users were exported from.
+func (g *Graph) Name() string {
+	return g.source
+}
+
+// RetrieveUser returns the user for the specified screen name.
+func (g *Graph) RetrieveUser(ctx context.Context, screenName string) (feeds.User, error) {
+	id, exists := g.names[strings.ToLower(screenName)]
+	if !exists {
+		return feeds.User{}, ErrNotFound
+	}
+
+	return g.RetrieveUserByID(ctx, id)
+}
+
+// RetrieveUserByID returns the user for the specified source id.
+func (g *Graph) RetrieveUserByID(ctx context.Context, id string) (feeds.User, error) {
+	i, exists := g.index[id]
+	if !exists {
+		return feeds.User{}, ErrNotFound
+	}
+
+	u := g.users[i]
+	u.Friends = nil
+
+	return u, nil
+}
+
+// RetrieveFriends returns the source ids of the users the specified
+// user follows.
+func (g *Graph) RetrieveFriends(ctx context.Context, id string) ([]string, error) {
+	if _, exists := g.index[id]; !exists {
+		return nil, ErrNotFound
+	}
+
+	return g.friends[id], nil
+}
+
+// =============================================================================
+
+// record represents a single line in the file.
+type record struct {
+	Type         string `json:"type"`
+	SourceID     string `json:"source_id"`
+	ScreenName   string `json:"screen_name"`
+	Name         string `json:"name"`
+	Location     string `json:"location"`
+	FriendsCount int    `json:"friends_count"`
+	FriendID     string `json:"friend_id"`
+}
+
+// addUser validates the user record and adds it to the graph.
+func (g *Graph) addUser(line int, rec record) error {
+	switch {
+	case rec.SourceID == "":
+		return errors.New("source_id is required")
+	case rec.ScreenName == "":
+		return errors.New("screen_name is required")
+	case rec.Name == "":
+		return errors.New("name is required")
+	case rec.FriendsCount < 0:
+		return errors.New("friends_count can't be negative")
+	}
+
+	if prev, exists := g.lines[rec.SourceID]; exists {
+		return fmt.Errorf("user %q already defined on line %d", rec.SourceID, prev)
+	}
+
+	g.index[rec.SourceID] = len(g.users)
+	g.lines[rec.SourceID] = line
+	g.names[strings.ToLower(rec.ScreenName)] = rec.SourceID
+	g.users = append(g.users, feeds.User{
+		SourceID:     rec.SourceID,
+		ScreenName:   rec.ScreenName,
+		Name:         rec.Name,
+		Location:     rec.Location,
+		FriendsCount: rec.FriendsCount,
+	})
+
+	return nil
+}
+
+// validateFollow validates the follow record.
+func validateFollow(rec record) error {
+	switch {
+	case rec.SourceID == "":
+		return errors.New("source_id is required")
+	case rec.FriendID == "":
+		return errors.New("friend_id is required")
+	}
+
+	return nil
+}
+
+// parseCSV parses a single line of a CSV file.
+func parseCSV(line string) (record, error) {
+	fields, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return record{}, fmt.Errorf("invalid csv: %w", err)
+	}
+
+	rec := record{Type: strings.ToLower(strings.TrimSpace(fields[0]))}
+
+	switch rec.Type {
+	case typeUser:
+		if len(fields) != 6 {
+			return record{}, fmt.Errorf("user record has %d fields, expected 6", len(fields))
+		}
+
+		rec.SourceID = strings.TrimSpace(fields[1])
+		rec.ScreenName = strings.TrimSpace(fields[2])
+		rec.Name = strings.TrimSpace(fields[3])
+		rec.Location = strings.TrimSpace(fields[4])
+
+		if count := strings.TrimSpace(fields[5]); count != "" {
+			if rec.FriendsCount, err = strconv.Atoi(count); err != nil {
+				return record{}, fmt.Errorf("invalid friends_count %q", count)
+			}
+		}
+
+	case typeFollow:
+		if len(fields) != 3 {
+			return record{}, fmt.Errorf("follow record has %d fields, expected 3", len(fields))
+		}
+
+		rec.SourceID = strings.TrimSpace(fields[1])
+		rec.FriendID = strings.TrimSpace(fields[2])
+	}
+
+	return rec, nil
+}
+
+// parseJSON parses a single line of a JSON Lines file.
+func parseJSON(line string) (record, error) {
+	var rec record
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return record{}, fmt.Errorf("invalid json: %w", err)
+	}
+
+	if rec.Type == "type" {
+		return record{}, errors.New(`record type "type" is reserved`)
+	}
+
+	return rec, nil
+}
@@ -0,0 +1,192 @@
+package edgelist_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/edgelist"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestLoad validates users and follow edges are read from both formats and
+// invalid records are reported by line.
+func TestLoad(t *testing.T) {
+	csv := `type,source_id,screen_name,name,location,friends_count
+# users
+user,1,bill,Bill,Miami,2
+follow,1,2
+user,2,jack,"Smith, Jack",,
+
+follow,1,3
+follow,2,1
+follow,2,9
+user,3,jane,Jane,,x
+user,1,again,Again,,0
+header,1
+type,again
+`
+
+	jsonl := `{"type":"user","source_id":"1","screen_name":"bill","name":"Bill","location":"Miami","friends_count":2}
+{"type":"follow","source_id":"1","friend_id":"2"}
+{"type":"user","source_id":"2","screen_name":"jack","name":"Smith, Jack"}
+
+{"type":"follow","source_id":"1","friend_id":"3"}
+{"type":"follow","source_id":"2","friend_id":"1"}
+{"type":"follow","source_id":"2","friend_id":"9"}
+{"type":"user","source_id":"3","screen_name":"jane"}
+{"type":"user","source_id":"1","screen_name":"again","name":"Again"}
+{"type":"header","source_id":"1"}
+{"type":"type"}
+`
+
+	table := []struct {
+		name   string
+		format string
+		data   string
+		lines  []int
+		jack   int
+	}{
+		{"csv", edgelist.CSV, csv, []int{7, 9, 10, 11, 12, 13}, 5},
+		{"jsonl", edgelist.JSONL, jsonl, []int{5, 7, 8, 9, 10, 11}, 3},
+	}
+
+	t.Log("Given the need to read a follow graph from a file.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen reading a %s file.", testID, tt.name)
+			{
+				g, err := edgelist.Load(strings.NewReader(tt.data), tt.format, "twitter")
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to load the file: %v", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to load the file.", tests.Success, testID)
+
+				expUsers := []feeds.User{
+					{SourceID: "1", ScreenName: "bill", Name: "Bill", Location: "Miami", FriendsCount: 2},
+					{SourceID: "2", ScreenName: "jack", Name: "Smith, Jack"},
+				}
+				expFriends := [][]string{{"2"}, {"1"}}
+
+				var users []feeds.User
+				var friends [][]string
+				for _, u := range g.Users() {
+					var ids []string
+					for _, f := range u.Friends {
+						ids = append(ids, f.SourceID)
+					}
+					friends = append(friends, ids)
+
+					u.Friends = nil
+					users = append(users, u)
+				}
+				if diff := cmp.Diff(expUsers, users); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the valid users. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the valid users.", tests.Success, testID)
+
+				if diff := cmp.Diff(expFriends, friends); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the friends of every user. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get back the friends of every user.", tests.Success, testID)
+
+				var edges []string
+				for _, e := range g.Edges() {
+					edges = append(edges, e.SourceID+"->"+e.FriendID)
+				}
+				if diff := cmp.Diff([]string{"1->2", "2->1"}, edges); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould only keep edges between known users. Diff:\n%s", tests.Failed, testID, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould only keep edges between known users.", tests.Success, testID)
+
+				var lines []int
+				for _, le := range g.Errors() {
+					lines = append(lines, le.Line)
+				}
+				if diff := cmp.Diff(tt.lines, lines); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould report every invalid record by line: %v. Diff:\n%s", tests.Failed, testID, g.Errors(), diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould report every invalid record by line.", tests.Success, testID)
+
+				if g.Line("2") != tt.jack {
+					t.Fatalf("\t%s\tTest %d:\tShould know the line each user is defined on, got %d.", tests.Failed, testID, g.Line("2"))
+				}
+				t.Logf("\t%s\tTest %d:\tShould know the line each user is defined on.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// TestSource validates the graph can be used as a source for a crawl.
+func TestSource(t *testing.T) {
+	data := `user,1,bill,Bill,Miami,1
+user,2,jack,Jack,,0
+follow,1,2
+`
+
+	t.Log("Given the need to crawl a follow graph read from a file.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen retrieving users and friends.", testID)
+		{
+			g, err := edgelist.Load(strings.NewReader(data), edgelist.CSV, "file")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the file: %v", tests.Failed, testID, err)
+			}
+
+			if g.Name() != "file" {
+				t.Fatalf("\t%s\tTest %d:\tShould be named after the source, got %q.", tests.Failed, testID, g.Name())
+			}
+			t.Logf("\t%s\tTest %d:\tShould be named after the source.", tests.Success, testID)
+
+			ctx := context.Background()
+
+			u, err := g.RetrieveUser(ctx, "BILL")
+			if err != nil || u.SourceID != "1" || u.Friends != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould retrieve a user by screen name without friends: %+v %v", tests.Failed, testID, u, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retrieve a user by screen name without friends.", tests.Success, testID)
+
+			ids, err := g.RetrieveFriends(ctx, "1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould retrieve the friends: %v", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"2"}, ids); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the friends. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the friends.", tests.Success, testID)
+
+			if _, err := g.RetrieveUserByID(ctx, "9"); err != edgelist.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find an unknown user: %v", tests.Failed, testID, err)
+			}
+			if _, err := g.RetrieveFriends(ctx, "9"); err != edgelist.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find the friends of an unknown user: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find an unknown user.", tests.Success, testID)
+		}
+	}
+}
+
+// TestFormatFromPath validates the format is chosen by file extension.
+func TestFormatFromPath(t *testing.T) {
+	t.Log("Given the need to know the format of a file.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen checking the extension.", testID)
+		{
+			for path, exp := range map[string]string{"a.csv": edgelist.CSV, "a.CSV": edgelist.CSV, "a.jsonl": edgelist.JSONL, "a.ndjson": edgelist.JSONL} {
+				if got, err := edgelist.FormatFromPath(path); err != nil || got != exp {
+					t.Fatalf("\t%s\tTest %d:\tShould detect %s for %s, got %q %v.", tests.Failed, testID, exp, path, got, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould detect the known formats.", tests.Success, testID)
+
+			if _, err := edgelist.FormatFromPath("a.txt"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an unknown extension.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject an unknown extension.", tests.Success, testID)
+		}
+	}
+}
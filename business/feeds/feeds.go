@@ -0,0 +1,32 @@
+package feeds
+
+import "context"
+
+// User represents an account retrieved from a source. The SourceID is the
+// id the account has inside the source.
+type User struct {
+	SourceID     string
+	ScreenName   string
+	Name         string
+	Location     string
+	FriendsCount int
+	Friends      []User
+}
+
+// Source represents a social network that can provide accounts and the
+// accounts they follow.
+type Source interface {
+
+	// Name returns the name of the network that is stored with each user.
+	Name() string
+
+	// RetrieveUser returns the account for the specified screen name.
+	RetrieveUser(ctx context.Context, screenName string) (User, error)
+
+	// RetrieveUserByID returns the account for the specified source id.
+	RetrieveUserByID(ctx context.Context, id string) (User, error)
+
+	// RetrieveFriends returns the source ids of the accounts the specified
+	// account follows.
+	RetrieveFriends(ctx context.Context, id string) ([]string, error)
+}
@@ -0,0 +1,225 @@
+// Package github provides support for extracting the accounts followed by
+// a GitHub user.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+)
+
+// User represents information about a github user.
+type User struct {
+	ID        int    `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	Following int    `json:"following"`
+}
+
+// toFeed converts a github user into a feeds user. GitHub users are not
+// required to set a name, so the login is used when it's missing.
+func toFeed(u User) feeds.User {
+	name := u.Name
+	if name == "" {
+		name = u.Login
+	}
+
+	return feeds.User{
+		SourceID:     strconv.Itoa(u.ID),
+		ScreenName:   u.Login,
+		Name:         name,
+		Location:     u.Location,
+		FriendsCount: u.Following,
+	}
+}
+
+// DefaultURL is the base url of the github API.
+const DefaultURL = "https://api.github.com"
+
+// GitHub represents the set of API's to access github data.
+type GitHub struct {
+	client http.Client
+	log    *log.Logger
+	url    string
+	token  string
+
+	mu     sync.Mutex
+	logins map[string]string
+}
+
+// New constructs a GitHub value for use. The token is optional but without
+// it github applies a much lower rate limit.
+func New(log *log.Logger, token string, options ...func(g *GitHub)) *GitHub {
+	client := http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+
+	g := GitHub{
+		client: client,
+		log:    log,
+		url:    DefaultURL,
+		token:  token,
+		logins: make(map[string]string),
+	}
+	for _, option := range options {
+		option(&g)
+	}
+	return &g
+}
+
+// WithBaseURL changes the base url used to access the github API.
+func WithBaseURL(url string) func(g *GitHub) {
+	return func(g *GitHub) {
+		g.url = strings.TrimRight(url, "/")
+	}
+}
+
+// Name returns the name of the source for users retrieved from github.
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+// RetrieveUser returns information for the specified login.
+func (g *GitHub) RetrieveUser(ctx context.Context, screenName string) (feeds.User, error) {
+	const githubURL = "%s/users/%s"
+
+	var u User
+	if _, err := g.get(ctx, fmt.Sprintf(githubURL, g.url, url.PathEscape(screenName)), &u); err != nil {
+		return feeds.User{}, err
+	}
+
+	g.log.Printf("%v", u)
+	g.remember(u)
+
+	return toFeed(u), nil
+}
+
+// RetrieveUserByID returns information for the specified user id. The id is
+// used as the source id since logins can be renamed.
+func (g *GitHub) RetrieveUserByID(ctx context.Context, id string) (feeds.User, error) {
+	const githubURL = "%s/user/%s"
+
+	var u User
+	if _, err := g.get(ctx, fmt.Sprintf(githubURL, g.url, url.PathEscape(id)), &u); err != nil {
+		return feeds.User{}, err
+	}
+
+	g.log.Printf("%v", u)
+	g.remember(u)
+
+	return toFeed(u), nil
+}
+
+// RetrieveFriends returns the ids of the users the specified user follows.
+// The results are paged by github and every page is read. The following
+// list is only addressable by login, so the login recorded when the user
+// was retrieved is used. Crawls and refreshes retrieve a profile before its
+// friends under their rate limiting, so the login is only looked up here
+// for accounts that were retrieved by an earlier run, like a resumed crawl.
+func (g *GitHub) RetrieveFriends(ctx context.Context, id string) ([]string, error) {
+	const githubURL = "%s/users/%s/following?per_page=100"
+
+	g.mu.Lock()
+	login, exists := g.logins[id]
+	g.mu.Unlock()
+
+	if !exists {
+		u, err := g.RetrieveUserByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		login = u.ScreenName
+	}
+
+	endpoint := fmt.Sprintf(githubURL, g.url, url.PathEscape(login))
+
+	var ids []string
+	for endpoint != "" {
+		var users []User
+		next, err := g.get(ctx, endpoint, &users)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range users {
+			ids = append(ids, strconv.Itoa(u.ID))
+		}
+		endpoint = next
+	}
+
+	return ids, nil
+}
+
+// remember records the login of the user so its friends can be retrieved.
+func (g *GitHub) remember(u User) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.logins[strconv.Itoa(u.ID)] = u.Login
+}
+
+// =============================================================================
+
+// linkNext matches the url of the next page in a Link header.
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// get performs a GET request against the specified url and decodes the
+// response into v. The url of the next page of results is returned if
+// github provided one.
+func (g *GitHub) get(ctx context.Context, endpoint string, v interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("github create request error: %w", err)
+	}
+
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if g.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("token %s", g.token))
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("github request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("github op error: status code: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("github decoding error: %w", err)
+	}
+
+	var next string
+	if match := linkNext.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		next = match[1]
+	}
+
+	return next, nil
+}
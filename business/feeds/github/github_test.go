@@ -0,0 +1,139 @@
+package github_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/github"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestGitHub validates users and the users they follow can be retrieved
+// from github.
+func TestGitHub(t *testing.T) {
+	t.Log("Given the need to retrieve users from github.")
+	{
+		var mu sync.Mutex
+		var auth string
+		var lookups int
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/users/bill", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			auth = r.Header.Get("Authorization")
+			mu.Unlock()
+			fmt.Fprint(w, `{"id":1,"login":"bill","name":"Bill","location":"Miami","following":3}`)
+		})
+		mux.HandleFunc("/user/2", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			lookups++
+			mu.Unlock()
+			fmt.Fprint(w, `{"id":2,"login":"jack","following":1}`)
+		})
+		mux.HandleFunc("/users/bill/following", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s/users/bill/following?per_page=100&page=2>; rel="next", <http://%s/users/bill/following?per_page=100&page=2>; rel="last"`, r.Host, r.Host))
+				fmt.Fprint(w, `[{"id":2,"login":"jack"},{"id":3,"login":"jane"}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id":4,"login":"joe"}]`)
+		})
+		mux.HandleFunc("/users/jack/following", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"id":1,"login":"bill"}]`)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		log := log.New(ioutil.Discard, "", 0)
+		g := github.New(log, "token", github.WithBaseURL(server.URL+"/"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen retrieving a user and the users followed.", testID)
+		{
+			u, err := g.RetrieveUser(ctx, "bill")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve a user by login: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve a user by login.", tests.Success, testID)
+
+			exp := feeds.User{SourceID: "1", ScreenName: "bill", Name: "Bill", Location: "Miami", FriendsCount: 3}
+			if diff := cmp.Diff(exp, u); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the user. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the user.", tests.Success, testID)
+
+			mu.Lock()
+			got := auth
+			mu.Unlock()
+			if got != "token token" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the token, got %q.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the token.", tests.Success, testID)
+
+			ids, err := g.RetrieveFriends(ctx, "1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the users followed: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve the users followed.", tests.Success, testID)
+
+			if diff := cmp.Diff([]string{"2", "3", "4"}, ids); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould read every page. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould read every page.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen retrieving a user by id and the users followed.", testID)
+		{
+			u, err := g.RetrieveUserByID(ctx, "2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve a user by id: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve a user by id.", tests.Success, testID)
+
+			if u.Name != "jack" {
+				t.Fatalf("\t%s\tTest %d:\tShould use the login when the name is missing, got %q.", tests.Failed, testID, u.Name)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the login when the name is missing.", tests.Success, testID)
+
+			if _, err := g.RetrieveFriends(ctx, "2"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the users followed: %v", tests.Failed, testID, err)
+			}
+
+			mu.Lock()
+			got := lookups
+			mu.Unlock()
+			if got != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould not look the login up again, got %d lookups.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not look the login up again.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen retrieving the users followed by a user not retrieved before.", testID)
+		{
+			g := github.New(log, "", github.WithBaseURL(server.URL))
+
+			ids, err := g.RetrieveFriends(ctx, "2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the users followed: %v", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"1"}, ids); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould look the login up first. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould look the login up first.", tests.Success, testID)
+		}
+	}
+}
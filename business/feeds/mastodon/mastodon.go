@@ -0,0 +1,197 @@
+// Package mastodon provides support for extracting the accounts followed by
+// an account on a Mastodon or other ActivityPub server that implements the
+// Mastodon client API.
+package mastodon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+)
+
+// Account represents information about a mastodon account.
+type Account struct {
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Acct           string `json:"acct"`
+	DisplayName    string `json:"display_name"`
+	FollowingCount int    `json:"following_count"`
+	Fields         []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+}
+
+// toFeed converts a mastodon account into a feeds user. Mastodon has no
+// location field, so a profile field named location is used if present.
+func toFeed(a Account) feeds.User {
+	u := feeds.User{
+		SourceID:     a.ID,
+		ScreenName:   a.Acct,
+		Name:         a.DisplayName,
+		FriendsCount: a.FollowingCount,
+	}
+
+	for _, field := range a.Fields {
+		if strings.EqualFold(field.Name, "location") {
+			u.Location = field.Value
+			break
+		}
+	}
+
+	return u
+}
+
+// Mastodon represents the set of API's to access mastodon data. Account ids
+// are local to the server being accessed.
+type Mastodon struct {
+	client http.Client
+	log    *log.Logger
+	url    string
+	host   string
+	token  string
+}
+
+// New constructs a Mastodon value for use against the specified server. The
+// token is optional and only needed for servers that restrict access.
+func New(log *log.Logger, serverURL string, token string) *Mastodon {
+	client := http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+
+	// A url that can't be parsed fails on first use, so the whole url
+	// stands in for the host until then.
+	host := serverURL
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Host)
+	}
+
+	return &Mastodon{
+		client: client,
+		log:    log,
+		url:    strings.TrimRight(serverURL, "/"),
+		host:   host,
+		token:  token,
+	}
+}
+
+// Name returns the name of the source for users retrieved from mastodon.
+// Account ids are only unique on the server that issued them, so the name
+// includes the host of the server, like mastodon:mastodon.social.
+func (m *Mastodon) Name() string {
+	return "mastodon:" + m.host
+}
+
+// RetrieveUser returns information for the specified account name. The name
+// can be a local username or a user@domain address.
+func (m *Mastodon) RetrieveUser(ctx context.Context, screenName string) (feeds.User, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/accounts/lookup?acct=%s", m.url, url.QueryEscape(strings.TrimPrefix(screenName, "@")))
+
+	var a Account
+	if _, err := m.get(ctx, endpoint, &a); err != nil {
+		return feeds.User{}, err
+	}
+
+	m.log.Printf("%v", a)
+
+	return toFeed(a), nil
+}
+
+// RetrieveUserByID returns information for the specified account id.
+func (m *Mastodon) RetrieveUserByID(ctx context.Context, id string) (feeds.User, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/accounts/%s", m.url, url.PathEscape(id))
+
+	var a Account
+	if _, err := m.get(ctx, endpoint, &a); err != nil {
+		return feeds.User{}, err
+	}
+
+	m.log.Printf("%v", a)
+
+	return toFeed(a), nil
+}
+
+// RetrieveFriends returns the ids of the accounts the specified account
+// follows. The results are paged by the server and every page is read.
+func (m *Mastodon) RetrieveFriends(ctx context.Context, id string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/accounts/%s/following?limit=80", m.url, url.PathEscape(id))
+
+	var ids []string
+	for endpoint != "" {
+		var accounts []Account
+		next, err := m.get(ctx, endpoint, &accounts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range accounts {
+			ids = append(ids, a.ID)
+		}
+		endpoint = next
+	}
+
+	return ids, nil
+}
+
+// =============================================================================
+
+// linkNext matches the url of the next page in a Link header.
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// get performs a GET request against the specified url and decodes the
+// response into v. The url of the next page of results is returned if the
+// server provided one.
+func (m *Mastodon) get(ctx context.Context, endpoint string, v interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("mastodon create request error: %w", err)
+	}
+
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Accept", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", m.token))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("mastodon request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mastodon op error: status code: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("mastodon decoding error: %w", err)
+	}
+
+	var next string
+	if match := linkNext.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		next = match[1]
+	}
+
+	return next, nil
+}
@@ -0,0 +1,113 @@
+package mastodon_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/mastodon"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestMastodon validates accounts and the accounts they follow can be
+// retrieved from a mastodon server.
+func TestMastodon(t *testing.T) {
+	t.Log("Given the need to retrieve accounts from a mastodon server.")
+	{
+		var auth string
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/accounts/lookup", func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			if r.URL.Query().Get("acct") != "bill@example.social" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, `{"id":"1","username":"bill","acct":"bill@example.social","display_name":"Bill","following_count":3,"fields":[{"name":"Location","value":"Miami"}]}`)
+		})
+		mux.HandleFunc("/api/v1/accounts/2", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":"2","username":"jack","acct":"jack","display_name":"Jack","following_count":0}`)
+		})
+		mux.HandleFunc("/api/v1/accounts/1/following", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("max_id") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v1/accounts/1/following?limit=80&max_id=9>; rel="next", <http://%s/api/v1/accounts/1/following?since_id=1>; rel="prev"`, r.Host, r.Host))
+				fmt.Fprint(w, `[{"id":"2"},{"id":"3"}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id":"4"}]`)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		log := log.New(ioutil.Discard, "", 0)
+		m := mastodon.New(log, server.URL+"/", "token")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen naming the source.", testID)
+		{
+			exp := "mastodon:" + strings.TrimPrefix(server.URL, "http://")
+			if got := m.Name(); got != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould include the host of the server, exp %q got %q.", tests.Failed, testID, exp, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould include the host of the server.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen retrieving accounts.", testID)
+		{
+			u, err := m.RetrieveUser(ctx, "@bill@example.social")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve an account by name: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve an account by name.", tests.Success, testID)
+
+			exp := feeds.User{SourceID: "1", ScreenName: "bill@example.social", Name: "Bill", Location: "Miami", FriendsCount: 3}
+			if diff := cmp.Diff(exp, u); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the account with its location. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the account with its location.", tests.Success, testID)
+
+			if auth != "Bearer token" {
+				t.Fatalf("\t%s\tTest %d:\tShould send the token, got %q.", tests.Failed, testID, auth)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send the token.", tests.Success, testID)
+
+			u, err = m.RetrieveUserByID(ctx, "2")
+			if err != nil || u.ScreenName != "jack" {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve an account by id: %+v %v", tests.Failed, testID, u, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve an account by id.", tests.Success, testID)
+
+			if _, err := m.RetrieveUserByID(ctx, "99"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail for an unknown account.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail for an unknown account.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen retrieving the accounts followed.", testID)
+		{
+			ids, err := m.RetrieveFriends(ctx, "1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the accounts followed: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve the accounts followed.", tests.Success, testID)
+
+			if diff := cmp.Diff([]string{"2", "3", "4"}, ids); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould read every page. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould read every page.", tests.Success, testID)
+		}
+	}
+}
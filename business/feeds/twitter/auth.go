@@ -0,0 +1,96 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// bearer manages the app bearer token used to authenticate with twitter.
+// When constructed with an API key and secret, the token is obtained using
+// the OAuth2 client credentials grant and cached until it is invalidated.
+type bearer struct {
+	apiKey    string
+	secretKey string
+
+	mu    sync.Mutex
+	token string
+}
+
+// renewable reports if a new token can be obtained from twitter.
+func (b *bearer) renewable() bool {
+	return b.apiKey != ""
+}
+
+// retrieve returns the cached token, obtaining a new one if required.
+func (b *bearer) retrieve(ctx context.Context, client *http.Client, baseURL string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.token != "" || !b.renewable() {
+		return b.token, nil
+	}
+
+	token, err := exchange(ctx, client, baseURL, b.apiKey, b.secretKey)
+	if err != nil {
+		return "", err
+	}
+	b.token = token
+
+	return b.token, nil
+}
+
+// invalidate drops the cached token if it's still the specified token. This
+// keeps concurrent callers from throwing away a token that was just renewed.
+func (b *bearer) invalidate(token string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.token == token {
+		b.token = ""
+	}
+}
+
+// exchange performs the client credentials grant to obtain an app bearer token.
+func exchange(ctx context.Context, client *http.Client, baseURL string, apiKey string, secretKey string) (string, error) {
+	const twitterURL = "%s/oauth2/token"
+
+	body := strings.NewReader("grant_type=client_credentials")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(twitterURL, baseURL), body)
+	if err != nil {
+		return "", fmt.Errorf("twitter create request error: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(apiKey), url.QueryEscape(secretKey))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("twitter request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("twitter op error: status code: %s", resp.Status)
+	}
+
+	var result struct {
+		TokenType   string `json:"token_type"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("twitter decoding error: %w", err)
+	}
+
+	if !strings.EqualFold(result.TokenType, "bearer") || result.AccessToken == "" {
+		return "", errors.New("twitter returned an invalid bearer token")
+	}
+
+	return result.AccessToken, nil
+}
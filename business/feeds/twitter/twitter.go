@@ -9,16 +9,18 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
-)
 
-// levels specifies how many layers of friends we will
-// retrieve from twitter.
-// const levels = 1
+	"github.com/ardanlabs/dgraph/business/feeds"
+)
 
 // User represents information about a twitter user.
 type User struct {
 	ID           int    `json:"id"`
+	IDStr        string `json:"id_str"`
 	ScreenName   string `json:"screen_name"`
 	Name         string `json:"name"`
 	Location     string `json:"location"`
@@ -26,116 +28,247 @@ type User struct {
 	Friends      []User
 }
 
+// toFeed converts a twitter user into a feeds user.
+func toFeed(u User) feeds.User {
+	return feeds.User{
+		SourceID:     u.IDStr,
+		ScreenName:   u.ScreenName,
+		Name:         u.Name,
+		Location:     u.Location,
+		FriendsCount: u.FriendsCount,
+	}
+}
+
+// DefaultURL is the base url of the twitter API.
+const DefaultURL = "https://api.twitter.com"
+
 // Twitter represents the set of API's to access twitter data.
 type Twitter struct {
 	client http.Client
 	log    *log.Logger
-	token  string
+	url    string
+	auth   *bearer
 }
 
-// New constructs a Twitter value for use.
-func New(log *log.Logger, token string) *Twitter {
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
+// New constructs a Twitter value for use with an existing app bearer token.
+func New(log *log.Logger, token string, options ...func(t *Twitter)) *Twitter {
+	t := Twitter{
+		client: newClient(),
+		log:    log,
+		url:    DefaultURL,
+		auth:   &bearer{token: token},
+	}
+	for _, option := range options {
+		option(&t)
 	}
+	return &t
+}
 
-	return &Twitter{
-		client: client,
-		log:    log,
-		token:  fmt.Sprintf("bearer %s", token),
+// NewWithKeys constructs a Twitter value for use that obtains the app bearer
+// token from the API key and secret. The token is retrieved on first use and
+// retrieved again if twitter stops accepting it.
+func NewWithKeys(log *log.Logger, apiKey string, secretKey string, options ...func(t *Twitter)) *Twitter {
+	t := New(log, "", options...)
+	t.auth = &bearer{
+		apiKey:    apiKey,
+		secretKey: secretKey,
 	}
+	return t
+}
+
+// WithBaseURL changes the base url used to access the twitter API. The url
+// is the scheme and host without the API version.
+func WithBaseURL(url string) func(t *Twitter) {
+	return func(t *Twitter) {
+		t.url = strings.TrimRight(url, "/")
+	}
+}
+
+// WithTransport changes the transport used to make requests to twitter.
+func WithTransport(transport http.RoundTripper) func(t *Twitter) {
+	return func(t *Twitter) {
+		t.client.Transport = transport
+	}
+}
+
+// Name returns the name of the source for users retrieved from twitter.
+func (t *Twitter) Name() string {
+	return "twitter"
 }
 
 // RetrieveUser returns information for the specifed screen name
 // includes their friends.
-func (t *Twitter) RetrieveUser(ctx context.Context, screenName string) (User, error) {
-	const twitterURL = "https://api.twitter.com/1.1/users/show.json?screen_name=%s"
+func (t *Twitter) RetrieveUser(ctx context.Context, screenName string) (feeds.User, error) {
+	const twitterURL = "%s/1.1/users/show.json?screen_name=%s"
 
-	url := fmt.Sprintf(twitterURL, screenName)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return User{}, fmt.Errorf("twitter create request error: %w", err)
+	var u User
+	if err := t.get(ctx, fmt.Sprintf(twitterURL, t.url, url.QueryEscape(screenName)), &u); err != nil {
+		return feeds.User{}, err
 	}
 
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", t.token)
+	t.log.Printf("%v", u)
 
-	resp, err := t.client.Do(req)
-	if err != nil {
-		return User{}, fmt.Errorf("twitter request error: %w", err)
-	}
-	defer resp.Body.Close()
+	return toFeed(u), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return User{}, fmt.Errorf("twitter op error: status code: %s", resp.Status)
-	}
+// RetrieveUserByID returns information for the specifed screen name
+// includes their friends.
+func (t *Twitter) RetrieveUserByID(ctx context.Context, id string) (feeds.User, error) {
+	const twitterURL = "%s/1.1/users/show.json?user_id=%s"
 
 	var u User
-	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
-		return User{}, fmt.Errorf("twitter decoding error: %w", err)
+	if err := t.get(ctx, fmt.Sprintf(twitterURL, t.url, url.QueryEscape(id)), &u); err != nil {
+		return feeds.User{}, err
 	}
 
 	t.log.Printf("%v", u)
 
-	return u, nil
+	return toFeed(u), nil
 }
 
-// RetrieveUserByID returns information for the specifed screen name
-// includes their friends.
-func (t *Twitter) RetrieveUserByID(ctx context.Context, id int) (User, error) {
-	const twitterURL = "https://api.twitter.com/1.1/users/show.json?user_id=%d"
+// RetrieveUsers returns information for up to 100 user ids in a single
+// request. Ids that don't exist are left out of the result.
+func (t *Twitter) RetrieveUsers(ctx context.Context, ids []string) ([]feeds.User, error) {
+	const twitterURL = "%s/1.1/users/lookup.json?user_id=%s"
 
-	url := fmt.Sprintf(twitterURL, id)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return User{}, fmt.Errorf("twitter create request error: %w", err)
+	if len(ids) > 100 {
+		return nil, fmt.Errorf("twitter lookup error: %d ids requested, max is 100", len(ids))
 	}
 
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", t.token)
+	var users []User
+	if err := t.get(ctx, fmt.Sprintf(twitterURL, t.url, url.QueryEscape(strings.Join(ids, ","))), &users); err != nil {
+		return nil, err
+	}
 
-	resp, err := t.client.Do(req)
-	if err != nil {
-		return User{}, fmt.Errorf("twitter request error: %w", err)
+	fus := make([]feeds.User, len(users))
+	for i, u := range users {
+		fus[i] = toFeed(u)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return User{}, fmt.Errorf("twitter op error: status code: %s", resp.Status)
+	return fus, nil
+}
+
+// RetrieveFriends returns the ids of the accounts the specified user
+// follows. Use RetrieveUserByID to hydrate each friend. Twitter pages the
+// ids and every page is read.
+func (t *Twitter) RetrieveFriends(ctx context.Context, id string) ([]string, error) {
+	const twitterURL = "%s/1.1/friends/ids.json?user_id=%s&stringify_ids=true&cursor=%s"
+
+	var ids []string
+	for cursor := "-1"; cursor != "0"; {
+		var friends struct {
+			IDS        []string `json:"ids"`
+			NextCursor string   `json:"next_cursor_str"`
+		}
+		if err := t.get(ctx, fmt.Sprintf(twitterURL, t.url, url.QueryEscape(id), cursor), &friends); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, friends.IDS...)
+
+		cursor = friends.NextCursor
+		if cursor == "" {
+			cursor = "0"
+		}
 	}
 
-	var u User
-	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
-		return User{}, fmt.Errorf("twitter decoding error: %w", err)
+	return ids, nil
+}
+
+// =============================================================================
+
+// maxRetries is the number of times a request is retried when twitter is
+// rate limiting or failing.
+const maxRetries = 5
+
+// get performs a GET request against the specified url and decodes the
+// response into v. If twitter rejects the bearer token and the token can
+// be renewed, the request is tried one more time. Rate limited and failed
+// requests are retried once the limit resets or after a backoff.
+func (t *Twitter) get(ctx context.Context, url string, v interface{}) error {
+	var renewed bool
+
+	for attempt := 0; ; attempt++ {
+		token, err := t.auth.retrieve(ctx, &t.client, t.url)
+		if err != nil {
+			return fmt.Errorf("twitter auth error: %w", err)
+		}
+
+		resp, err := t.do(ctx, url, token)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && t.auth.renewable() && !renewed:
+			resp.Body.Close()
+			t.auth.invalidate(token)
+			renewed = true
+			continue
+
+		case retryable(resp.StatusCode) && attempt < maxRetries:
+			wait := backoff(resp, attempt)
+			resp.Body.Close()
+
+			t.log.Printf("twitter: %s: retrying in %v", resp.Status, wait)
+			if err := sleep(ctx, wait); err != nil {
+				return fmt.Errorf("twitter op error: status code: %s: %w", resp.Status, err)
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("twitter op error: status code: %s", resp.Status)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("twitter decoding error: %w", err)
+		}
+
+		return nil
 	}
+}
 
-	t.log.Printf("%v", u)
+// retryable reports if a request that failed with the status code can be
+// tried again.
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// backoff returns how long to wait before retrying a failed request. When
+// rate limited, twitter reports when the limit resets in whole seconds so
+// an extra second is added. Otherwise the wait doubles with each attempt.
+func backoff(resp *http.Response, attempt int) time.Duration {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if reset, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0))
+			if wait < 0 {
+				wait = 0
+			}
+			return wait + time.Second
+		}
+	}
 
-	return u, nil
+	return (100 * time.Millisecond) << uint(attempt)
 }
 
-// RetrieveFriends returns information for the specifed screen name
-// includes their friends.
-func (t *Twitter) RetrieveFriends(ctx context.Context, id int) ([]User, error) {
-	const twitterURL = "https://api.twitter.com/1.1/friends/ids.json?user_id=%d"
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
 
-	url := fmt.Sprintf(twitterURL, id)
+// do executes a single GET request using the specified bearer token.
+func (t *Twitter) do(ctx context.Context, url string, token string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("twitter create request error: %w", err)
@@ -144,38 +277,31 @@ func (t *Twitter) RetrieveFriends(ctx context.Context, id int) ([]User, error) {
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", t.token)
+	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", token))
 
 	resp, err := t.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("twitter request error: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("twitter op error: status code: %s", resp.Status)
-	}
 
-	var friends struct {
-		IDS []int `json:"ids"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&friends); err != nil {
-		return nil, fmt.Errorf("twitter decoding error: %w", err)
-	}
-
-	limit := 20
-	users := make([]User, len(friends.IDS))
-	for i, id := range friends.IDS {
-		u, err := t.RetrieveUserByID(ctx, id)
-		if err != nil {
-			return nil, fmt.Errorf("twitter retrieve user: %w", err)
-		}
-		users[i] = u
+	return resp, nil
+}
 
-		if limit--; limit == 0 {
-			break
-		}
+// newClient constructs the http client used to talk to twitter.
+func newClient() http.Client {
+	return http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
 	}
-
-	return users, nil
 }
@@ -0,0 +1,232 @@
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/dgraph/business/feeds"
+	"github.com/ardanlabs/dgraph/business/feeds/twitter"
+	"github.com/ardanlabs/dgraph/business/feeds/twitter/twittertest"
+	"github.com/ardanlabs/dgraph/foundation/cassette"
+	"github.com/ardanlabs/dgraph/foundation/tests"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestTwitter validates the twitter client using recorded interactions.
+func TestTwitter(t *testing.T) {
+	t.Run("replay", replay)
+	t.Run("record", record)
+	t.Run("lookup", lookup)
+}
+
+// crawl runs a single level crawl from the specified screen name and
+// returns the results sorted by source id.
+func crawl(t *testing.T, testID int, tw *twitter.Twitter, screenName string) []feeds.Result {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	root, err := tw.RetrieveUser(ctx, screenName)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the root user: %v", tests.Failed, testID, err)
+	}
+	t.Logf("\t%s\tTest %d:\tShould be able to retrieve the root user.", tests.Success, testID)
+
+	crawler := feeds.NewCrawler(tw, feeds.Config{Workers: 2, Levels: 1})
+
+	var results []feeds.Result
+	for result := range crawler.Crawl(ctx, root) {
+		if result.Err != nil {
+			t.Fatalf("\t%s\tTest %d:\tShould be able to crawl user %s: %v", tests.Failed, testID, result.User.SourceID, result.Err)
+		}
+		results = append(results, result)
+	}
+	t.Logf("\t%s\tTest %d:\tShould be able to crawl the friends.", tests.Success, testID)
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].User.SourceID < results[j].User.SourceID
+	})
+
+	return results
+}
+
+// replay validates a crawl can be replayed from a fixture, including the
+// renewal of an expired bearer token.
+func replay(t *testing.T) {
+	t.Log("Given the need to crawl twitter from recorded interactions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen replaying a crawl of one level with an expired token.", testID)
+		{
+			transport, err := cassette.New(filepath.Join("testdata", "crawl.json"), cassette.ModeReplay, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the fixture: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the fixture.", tests.Success, testID)
+
+			log := log.New(ioutil.Discard, "", 0)
+			tw := twitter.NewWithKeys(log, "key", "secret", twitter.WithTransport(transport))
+
+			exp := []feeds.Result{
+				{User: feeds.User{SourceID: "100", ScreenName: "goinggodotnet", Name: "William Kennedy", Location: "Miami", FriendsCount: 2}},
+				{User: feeds.User{SourceID: "200", ScreenName: "jacksmith", Name: "Jack Smith", Location: "Miami, FL", FriendsCount: 10}, Followers: []string{"100"}, Level: 1},
+				{User: feeds.User{SourceID: "300", ScreenName: "janedoe", Name: "Jane Doe"}, Followers: []string{"100"}, Level: 1},
+			}
+
+			got := crawl(t, testID, tw, "goinggodotnet")
+			if diff := cmp.Diff(exp, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the recorded users. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the recorded users.", tests.Success, testID)
+		}
+	}
+}
+
+// record validates a crawl can be recorded and then replayed once the
+// server is no longer available.
+func record(t *testing.T) {
+	t.Log("Given the need to record twitter interactions for later use.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen recording a crawl of one level.", testID)
+		{
+			users := map[string]string{
+				"1": `{"id":1,"id_str":"1","screen_name":"root","name":"Root"}`,
+				"2": `{"id":2,"id_str":"2","screen_name":"friend","name":"Friend"}`,
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Set-Cookie", "guest_id=secret")
+				fmt.Fprint(w, `{"token_type":"bearer","access_token":"live-token"}`)
+			})
+			mux.HandleFunc("/1.1/users/show.json", func(w http.ResponseWriter, r *http.Request) {
+				id := r.URL.Query().Get("user_id")
+				if r.URL.Query().Get("screen_name") == "root" {
+					id = "1"
+				}
+				fmt.Fprint(w, users[id])
+			})
+			mux.HandleFunc("/1.1/friends/ids.json", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"ids":["2"]}`)
+			})
+			server := httptest.NewServer(mux)
+
+			dir, err := ioutil.TempDir("", "cassette")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a temp dir: %v", tests.Failed, testID, err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "record.json")
+			log := log.New(ioutil.Discard, "", 0)
+
+			transport, err := cassette.New(path, cassette.ModeRecord, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the cassette: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create the cassette.", tests.Success, testID)
+
+			tw := twitter.NewWithKeys(log, "key", "secret", twitter.WithBaseURL(server.URL), twitter.WithTransport(transport))
+			recorded := crawl(t, testID, tw, "root")
+			server.Close()
+
+			if err := transport.Close(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to save the recording: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to save the recording.", tests.Success, testID)
+
+			if len(recorded) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get back 2 users from the server, got %d.", tests.Failed, testID, len(recorded))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back 2 users from the server.", tests.Success, testID)
+
+			fixture, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the recording: %v", tests.Failed, testID, err)
+			}
+			if strings.Contains(string(fixture), "live-token") || strings.Contains(string(fixture), "guest_id") {
+				t.Fatalf("\t%s\tTest %d:\tShould not record credentials:\n%s", tests.Failed, testID, fixture)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not record credentials.", tests.Success, testID)
+
+			transport, err = cassette.New(path, cassette.ModeReplay, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the recording: %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the recording.", tests.Success, testID)
+
+			tw = twitter.NewWithKeys(log, "key", "secret", twitter.WithBaseURL(server.URL), twitter.WithTransport(transport))
+			replayed := crawl(t, testID, tw, "root")
+
+			if diff := cmp.Diff(recorded, replayed); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same users. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same users.", tests.Success, testID)
+		}
+	}
+}
+
+// lookup validates users can be retrieved in bulk from the fake API,
+// including when the server fails a request.
+func lookup(t *testing.T) {
+	t.Log("Given the need to retrieve many twitter users in a single request.")
+	{
+		graph := twittertest.Generate(5, 2, 1)
+		server := twittertest.NewServer(graph, twittertest.WithErrors(2, http.StatusServiceUnavailable))
+		defer server.Close()
+
+		log := log.New(ioutil.Discard, "", 0)
+		tw := twitter.New(log, "token", twitter.WithBaseURL(server.URL))
+
+		var exp []feeds.User
+		ids := []string{"999"}
+		for _, u := range graph.Users[1:4] {
+			id := fmt.Sprint(u.ID)
+			ids = append(ids, id)
+			exp = append(exp, feeds.User{SourceID: id, ScreenName: u.ScreenName, Name: u.Name, Location: u.Location, FriendsCount: len(graph.Friends[u.ID])})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		testID := 0
+		t.Logf("\tTest %d:\tWhen looking up users that exist and one that doesn't.", testID)
+		{
+			got, err := tw.RetrieveUsers(ctx, ids)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up the users: %v", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(exp, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the users that exist. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the users that exist.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the server fails the lookup.", testID)
+		{
+			got, err := tw.RetrieveUsers(ctx, ids)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up the users: %v", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(exp, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the users that exist. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			if server.Requests() != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould retry the failed request, got %d requests.", tests.Failed, testID, server.Requests())
+			}
+			t.Logf("\t%s\tTest %d:\tShould retry the failed request.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Package twittertest provides a fake twitter API server for tests. It
+// serves a synthetic social graph and can inject rate limiting, server
+// errors and latency so crawls can be tested without network access.
+package twittertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User represents an account in the synthetic graph.
+type User struct {
+	ID         int64
+	ScreenName string
+	Name       string
+	Location   string
+}
+
+// Graph represents a synthetic social graph. Friends holds the ids of the
+// accounts each account follows.
+type Graph struct {
+	Users   []User
+	Friends map[int64][]int64
+}
+
+// Generate constructs a graph of the specified number of users where every
+// user follows up to the specified number of other users. The same seed
+// always produces the same graph.
+func Generate(users int, friends int, seed int64) Graph {
+	rnd := rand.New(rand.NewSource(seed))
+
+	g := Graph{
+		Users:   make([]User, users),
+		Friends: make(map[int64][]int64),
+	}
+
+	for i := range g.Users {
+		g.Users[i] = User{
+			ID:         int64(1000 + i),
+			ScreenName: fmt.Sprintf("user%d", i),
+			Name:       fmt.Sprintf("User %d", i),
+			Location:   fmt.Sprintf("City %d", i%10),
+		}
+	}
+
+	for _, u := range g.Users {
+		for _, i := range rnd.Perm(users) {
+			if len(g.Friends[u.ID]) == friends {
+				break
+			}
+			if id := g.Users[i].ID; id != u.ID {
+				g.Friends[u.ID] = append(g.Friends[u.ID], id)
+			}
+		}
+	}
+
+	return g
+}
+
+// Server represents a fake twitter API serving a graph.
+type Server struct {
+	*httptest.Server
+	graph    Graph
+	users    map[int64]User
+	names    map[string]int64
+	pageSize int
+	latency  time.Duration
+
+	mu          sync.Mutex
+	requests    int
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	windowCount int
+	failEvery   int
+	failStatus  int
+}
+
+// NewServer starts a fake twitter API serving the specified graph. The
+// caller must call Close when finished.
+func NewServer(graph Graph, options ...func(s *Server)) *Server {
+	s := Server{
+		graph:    graph,
+		users:    make(map[int64]User),
+		names:    make(map[string]int64),
+		pageSize: 5000,
+	}
+	for _, u := range graph.Users {
+		s.users[u.ID] = u
+		s.names[strings.ToLower(u.ScreenName)] = u.ID
+	}
+	for _, option := range options {
+		option(&s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", s.token)
+	mux.HandleFunc("/1.1/users/show.json", s.show)
+	mux.HandleFunc("/1.1/users/lookup.json", s.lookup)
+	mux.HandleFunc("/1.1/friends/ids.json", s.friendIDs)
+
+	s.Server = httptest.NewServer(s.faults(mux))
+	return &s
+}
+
+// WithPageSize sets the number of ids returned per page by friends/ids.
+func WithPageSize(size int) func(s *Server) {
+	return func(s *Server) {
+		s.pageSize = size
+	}
+}
+
+// WithLatency delays every response by the specified duration.
+func WithLatency(latency time.Duration) func(s *Server) {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// WithRateLimit allows only limit requests per window. Requests over the
+// limit receive a 429 with the time the window resets.
+func WithRateLimit(limit int, window time.Duration) func(s *Server) {
+	return func(s *Server) {
+		s.limit = limit
+		s.window = window
+	}
+}
+
+// WithErrors fails every nth request with the specified status code.
+func WithErrors(every int, status int) func(s *Server) {
+	return func(s *Server) {
+		s.failEvery = every
+		s.failStatus = status
+	}
+}
+
+// Requests returns the number of requests the server has received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// =============================================================================
+
+// faults applies the configured latency, rate limit and errors before
+// handing the request to the api.
+func (s *Server) faults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.latency > 0 {
+			select {
+			case <-time.After(s.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		s.mu.Lock()
+		s.requests++
+		fail := s.failEvery > 0 && s.requests%s.failEvery == 0
+
+		var limited bool
+		var reset time.Time
+		if s.limit > 0 {
+			now := time.Now()
+			if now.Sub(s.windowStart) >= s.window {
+				s.windowStart = now
+				s.windowCount = 0
+			}
+			s.windowCount++
+			limited = s.windowCount > s.limit
+			reset = s.windowStart.Add(s.window)
+		}
+		s.mu.Unlock()
+
+		switch {
+		case limited:
+			w.Header().Set("x-rate-limit-limit", strconv.Itoa(s.limit))
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+			respondError(w, http.StatusTooManyRequests, 88, "Rate limit exceeded")
+
+		case fail:
+			respondError(w, s.failStatus, 131, "Internal error")
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// token handles the client credentials grant.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok || r.Method != http.MethodPost {
+		respondError(w, http.StatusForbidden, 99, "Unable to verify your credentials")
+		return
+	}
+
+	respond(w, map[string]string{"token_type": "bearer", "access_token": "twittertest"})
+}
+
+// show handles users/show for a single user id or screen name.
+func (s *Server) show(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.find(r.URL.Query().Get("user_id"), r.URL.Query().Get("screen_name"))
+	if !ok {
+		respondError(w, http.StatusNotFound, 50, "User not found.")
+		return
+	}
+
+	respond(w, s.profile(id))
+}
+
+// lookup handles users/lookup for a comma separated list of user ids or
+// screen names.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	var profiles []map[string]interface{}
+
+	for _, id := range splitList(r.URL.Query().Get("user_id")) {
+		if id, ok := s.find(id, ""); ok {
+			profiles = append(profiles, s.profile(id))
+		}
+	}
+	for _, name := range splitList(r.URL.Query().Get("screen_name")) {
+		if id, ok := s.find("", name); ok {
+			profiles = append(profiles, s.profile(id))
+		}
+	}
+
+	if len(profiles) == 0 {
+		respondError(w, http.StatusNotFound, 17, "No user matches for specified terms.")
+		return
+	}
+
+	respond(w, profiles)
+}
+
+// friendIDs handles friends/ids with cursor based paging.
+func (s *Server) friendIDs(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.find(r.URL.Query().Get("user_id"), r.URL.Query().Get("screen_name"))
+	if !ok {
+		respondError(w, http.StatusNotFound, 34, "Sorry, that page does not exist.")
+		return
+	}
+
+	cursor, err := strconv.Atoi(r.URL.Query().Get("cursor"))
+	if err != nil || cursor < 0 {
+		cursor = 0
+	}
+
+	friends := s.graph.Friends[id]
+	if cursor > len(friends) {
+		cursor = len(friends)
+	}
+	end := cursor + s.pageSize
+	if end > len(friends) {
+		end = len(friends)
+	}
+
+	next := 0
+	if end < len(friends) {
+		next = end
+	}
+
+	page := friends[cursor:end]
+	stringify := r.URL.Query().Get("stringify_ids") == "true"
+
+	ids := make([]interface{}, len(page))
+	for i, id := range page {
+		ids[i] = id
+		if stringify {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+	}
+
+	respond(w, map[string]interface{}{
+		"ids":                 ids,
+		"next_cursor":         next,
+		"next_cursor_str":     strconv.Itoa(next),
+		"previous_cursor":     0,
+		"previous_cursor_str": "0",
+	})
+}
+
+// find locates a user by id or screen name.
+func (s *Server) find(userID string, screenName string) (int64, bool) {
+	if screenName != "" {
+		id, ok := s.names[strings.ToLower(screenName)]
+		return id, ok
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	_, ok := s.users[id]
+	return id, ok
+}
+
+// profile returns the api representation of a user.
+func (s *Server) profile(id int64) map[string]interface{} {
+	u := s.users[id]
+
+	return map[string]interface{}{
+		"id":            u.ID,
+		"id_str":        strconv.FormatInt(u.ID, 10),
+		"screen_name":   u.ScreenName,
+		"name":          u.Name,
+		"location":      u.Location,
+		"friends_count": len(s.graph.Friends[id]),
+	}
+}
+
+// splitList splits a comma separated query parameter.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
+
+// respond writes the value as a json response.
+func respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// respondError writes an error in the format twitter uses.
+func respondError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{
+			{"code": code, "message": message},
+		},
+	})
+}
@@ -0,0 +1,350 @@
+// Package cassette provides an http transport that records the requests made
+// by a client and their responses to a fixture file, so they can be replayed
+// later without network access.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ardanlabs/dgraph/foundation/file"
+)
+
+// Set of modes a cassette can operate in.
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// Interaction represents a single request and the response that was
+// received for it.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request represents the parts of a request used to find its response.
+// Headers are not recorded since they carry the credentials of the client.
+// The body is recorded as sent since it's needed to find the response.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response represents a recorded response. Only the headers a client needs
+// to interpret the response are recorded and well known token fields in a
+// JSON body are redacted, see RecordedHeaders and RedactedFields.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// RecordedHeaders lists the response headers that are recorded. Headers
+// starting with X-Rate-Limit- are recorded as well. Every other header, like
+// Set-Cookie, is dropped.
+var RecordedHeaders = []string{"Content-Type", "Link", "Retry-After"}
+
+// RedactedFields lists the fields of a JSON response body whose values are
+// replaced with Redacted before the response is recorded.
+var RedactedFields = []string{"access_token", "refresh_token", "id_token", "accessJWT", "refreshJWT"}
+
+// Redacted replaces the value of a field that isn't recorded.
+const Redacted = "REDACTED"
+
+// Transport is an http.RoundTripper that records or replays interactions.
+// In replay mode, identical requests are answered in the order they were
+// recorded, with the last response repeating once they run out.
+type Transport struct {
+	path   string
+	mode   string
+	next   http.RoundTripper
+	redact func(in *Interaction)
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         map[int]bool
+}
+
+// New constructs a Transport for the fixture file at the specified path.
+// In record mode, requests are sent using the next transport and the file
+// is written once the transport is closed. In replay mode, the file must
+// exist and no request leaves the process.
+func New(path string, mode string, next http.RoundTripper, options ...func(t *Transport)) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	t := Transport{
+		path: path,
+		mode: mode,
+		next: next,
+		used: make(map[int]bool),
+	}
+	for _, option := range options {
+		option(&t)
+	}
+
+	switch mode {
+	case ModeRecord:
+	case ModeReplay:
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cassette: reading fixture: %w", err)
+		}
+		if err := json.Unmarshal(data, &t.interactions); err != nil {
+			return nil, fmt.Errorf("cassette: decoding fixture: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", mode)
+	}
+
+	return &t, nil
+}
+
+// WithRedact adds a function that removes anything else that must not end up
+// in the fixture. It's called with every interaction before it's recorded,
+// after the headers are dropped and the token fields redacted. The client
+// still receives the response as it was sent. Changing the request breaks
+// the replay of the interaction.
+func WithRedact(redact func(in *Interaction)) func(t *Transport) {
+	return func(t *Transport) {
+		t.redact = redact
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("cassette: reading request body: %w", err)
+		}
+		req.Body.Close()
+	}
+
+	r := Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Body:   string(body),
+	}
+
+	if t.mode == ModeReplay {
+		return t.replay(req, r)
+	}
+
+	return t.record(req, r, body)
+}
+
+// Close writes the recorded interactions to the fixture file. Nothing is
+// written in replay mode.
+func (t *Transport) Close() error {
+	if t.mode != ModeRecord {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.save()
+}
+
+// Interactions returns a copy of the interactions held by the cassette.
+func (t *Transport) Interactions() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Interaction(nil), t.interactions...)
+}
+
+// =============================================================================
+
+// replay finds the recorded response for the request.
+func (t *Transport) replay(req *http.Request, r Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last := -1
+	for i, in := range t.interactions {
+		if in.Request != r {
+			continue
+		}
+		last = i
+		if !t.used[i] {
+			break
+		}
+	}
+
+	if last == -1 {
+		return nil, errors.New("cassette: no recorded response for " + r.Method + " " + r.URL)
+	}
+	t.used[last] = true
+
+	return newResponse(req, t.interactions[last].Response), nil
+}
+
+// record sends the request and keeps the interaction to be saved on close.
+func (t *Transport) record(req *http.Request, r Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: reading response body: %w", err)
+	}
+
+	rec := Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(data),
+	}
+
+	in := Interaction{
+		Request: r,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     recordedHeader(resp.Header),
+			Body:       redactBody(data),
+		},
+	}
+	if t.redact != nil {
+		t.redact(&in)
+	}
+
+	t.mu.Lock()
+	t.interactions = append(t.interactions, in)
+	t.mu.Unlock()
+
+	return newResponse(req, rec), nil
+}
+
+// recordedHeader returns the headers of the response that are recorded.
+func recordedHeader(header http.Header) http.Header {
+	rec := make(http.Header)
+	for _, key := range RecordedHeaders {
+		if values := header.Values(key); len(values) > 0 {
+			rec[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+	for key, values := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), "X-Rate-Limit-") {
+			rec[key] = append([]string(nil), values...)
+		}
+	}
+
+	if len(rec) == 0 {
+		return nil
+	}
+	return rec
+}
+
+// redactBody replaces the values of the redacted fields found at any depth
+// of a JSON body. Bodies that aren't JSON are recorded as is.
+func redactBody(data []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return string(data)
+	}
+
+	if !redactValue(doc) {
+		return string(data)
+	}
+
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return string(data)
+	}
+	return string(redacted)
+}
+
+// redactValue walks the decoded JSON value and reports if any field was
+// redacted.
+func redactValue(v interface{}) bool {
+	var redacted bool
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isRedacted(key) {
+				if value != nil && value != "" {
+					v[key] = Redacted
+					redacted = true
+				}
+				continue
+			}
+			if redactValue(value) {
+				redacted = true
+			}
+		}
+
+	case []interface{}:
+		for _, value := range v {
+			if redactValue(value) {
+				redacted = true
+			}
+		}
+	}
+
+	return redacted
+}
+
+// isRedacted reports if the field is one of the redacted fields.
+func isRedacted(key string) bool {
+	for _, field := range RedactedFields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the interactions to the fixture file. The file is replaced
+// atomically so a failure never leaves a partial fixture.
+func (t *Transport) save() error {
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: encoding fixture: %w", err)
+	}
+
+	if err := file.WriteAtomic(t.path, data, 0644); err != nil {
+		return fmt.Errorf("cassette: writing fixture: %w", err)
+	}
+
+	return nil
+}
+
+// newResponse constructs an http response from a recorded response.
+func newResponse(req *http.Request, r Response) *http.Response {
+	header := r.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
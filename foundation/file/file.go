@@ -0,0 +1,78 @@
+// Package file provides support for writing files safely.
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes the data to the named file so that a reader or a crash
+// never sees a partially written file. The data is written and synced to a
+// temporary file in the same directory which then replaces the named file.
+func WriteAtomic(name string, data []byte, perm os.FileMode) error {
+	return WriteAtomicFunc(name, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteAtomicFunc is like WriteAtomic for data that is streamed by the write
+// function instead of held in memory. The named file is left untouched if
+// the write function fails.
+func WriteAtomicFunc(name string, perm os.FileMode, write func(w io.Writer) error) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	tmp := f.Name()
+
+	// Make sure the temp file doesn't stick around on failure.
+	defer os.Remove(tmp)
+
+	// The error of the write function is returned as is since it belongs
+	// to the caller.
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+
+	if err := os.Chmod(tmp, perm); err != nil {
+		return fmt.Errorf("setting permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("replacing file: %w", err)
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+// Package rate provides support for limiting how often an operation can
+// be performed across a set of goroutines.
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter controls how frequently events are allowed to happen. It allows
+// bursts of up to burst events and then one event per interval.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	tat      time.Time
+}
+
+// New constructs a Limiter that allows one event per interval with bursts
+// of up to burst events. An interval of zero disables limiting.
+func New(interval time.Duration, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		interval: interval,
+		burst:    burst,
+	}
+}
+
+// Wait blocks until the next event is allowed or the context is done. When
+// the context is done first, the event is given back so it doesn't delay
+// the callers still waiting. It is safe to call Wait from multiple
+// goroutines.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+
+	// The theoretical arrival time tracks when the bucket would be empty
+	// again. An event is allowed once we are within burst intervals of it.
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	allowAt := tat.Add(-time.Duration(l.burst-1) * l.interval)
+	l.tat = tat.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := allowAt.Sub(now)
+	if wait <= 0 {
+		if err := ctx.Err(); err != nil {
+			l.cancel()
+			return err
+		}
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// cancel gives back an event that was reserved but never happened.
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tat = l.tat.Add(-l.interval)
+}
@@ -0,0 +1,172 @@
+// Package trace provides support for recording spans of work and handing
+// them to an exporter. Spans are shaped after OpenTelemetry spans so the
+// output can be loaded into tools that understand them.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Status codes for a span, as defined by OpenTelemetry.
+const (
+	StatusUnset = "STATUS_CODE_UNSET"
+	StatusOK    = "STATUS_CODE_OK"
+	StatusError = "STATUS_CODE_ERROR"
+)
+
+// Exporter is the behavior required to receive spans once they end.
+type Exporter interface {
+	Export(span SpanData) error
+}
+
+// SpanData represents a span that has ended.
+type SpanData struct {
+	TraceID       string                 `json:"traceId"`
+	SpanID        string                 `json:"spanId"`
+	ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+	Name          string                 `json:"name"`
+	StartTime     time.Time              `json:"startTime"`
+	EndTime       time.Time              `json:"endTime"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	StatusCode    string                 `json:"statusCode"`
+	StatusMessage string                 `json:"statusMessage,omitempty"`
+}
+
+// Tracer starts spans and hands them to its exporter once they end.
+type Tracer struct {
+	exporter Exporter
+}
+
+// New constructs a Tracer that exports spans to the specified exporter.
+func New(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+	}
+}
+
+// Span represents a unit of work being traced.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+}
+
+// ctxKey is how a span is stored in a context.
+type ctxKey int
+
+const key ctxKey = 1
+
+// Start begins a span with the specified name. If the context holds a span,
+// the new span becomes its child. A nil Tracer returns a span that does
+// nothing, so callers don't need to check if tracing is enabled.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, &Span{}
+	}
+
+	span := Span{
+		tracer: t,
+		data: SpanData{
+			SpanID:     newID(8),
+			Name:       name,
+			StartTime:  time.Now(),
+			Attributes: make(map[string]interface{}),
+			StatusCode: StatusUnset,
+		},
+	}
+
+	if parent, ok := ctx.Value(key).(*Span); ok && parent.tracer != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentSpanID = parent.data.SpanID
+	} else {
+		span.data.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, key, &span), &span
+}
+
+// SetAttribute records a key/value pair describing the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s.tracer == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// TraceParent returns the span as a W3C traceparent header so the service
+// receiving a request can continue the trace. A span that does nothing
+// returns an empty string.
+func (s *Span) TraceParent() string {
+	if s.tracer == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+// End completes the span and exports it. If the work failed, the error is
+// recorded as the status of the span.
+func (s *Span) End(err error) error {
+	if s.tracer == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.data.EndTime = time.Now()
+	s.data.StatusCode = StatusOK
+	if err != nil {
+		s.data.StatusCode = StatusError
+		s.data.StatusMessage = err.Error()
+	}
+	data := s.data
+	s.mu.Unlock()
+
+	if err := s.tracer.exporter.Export(data); err != nil {
+		return fmt.Errorf("exporting span: %w", err)
+	}
+	return nil
+}
+
+// =============================================================================
+
+// JSONExporter writes every span as a line of JSON. It can be used to export
+// spans to stdout or a file for local use.
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONExporter constructs an exporter that writes to the specified writer.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Export implements the Exporter interface. It is safe to call Export from
+// multiple goroutines.
+func (je *JSONExporter) Export(span SpanData) error {
+	je.mu.Lock()
+	defer je.mu.Unlock()
+
+	return je.enc.Encode(span)
+}
+
+// newID returns a random identifier of n bytes encoded as hex.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}